@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// requireAdmin checks the request's ApiKey against ADMIN_KEY, writing a 401
+// if it doesn't match. With no ADMIN_KEY configured nothing matches.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.AdminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminKey)) != 1 {
+		log.Printf("admin key missing or doesn't match")
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return false
+	}
+	return true
+}
+
+// setBanned bans or unbans the user named in the path. A ban also ends every
+// session and deletes the user's personal access tokens, so nothing they
+// hold works afterwards, even once unbanned.
+func (cfg *apiConfig) setBanned(w http.ResponseWriter, r *http.Request, banned bool) {
+
+	// admins only
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	// parse user id
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse user id"})
+		return
+	}
+
+	// flag the account
+	n, err := cfg.Queries.SetUserBanned(r.Context(), database.SetUserBannedParams{
+		Banned: banned,
+		ID:     userID,
+	})
+	if err != nil {
+		log.Printf("Error updating ban: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if n == 0 {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+
+	// and throw the user out
+	if banned {
+		err = cfg.endAllSessions(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error ending sessions of banned user: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+		err = cfg.Queries.DeleteAPITokensForUser(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error deleting API tokens of banned user: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+		logSecurityEvent(r, "user_banned", userID, "sessions and API tokens revoked")
+	} else {
+		logSecurityEvent(r, "user_unbanned", userID, "")
+	}
+
+	w.WriteHeader(204)
+
+}
+
+func (cfg *apiConfig) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setBanned(w, r, true)
+}
+
+func (cfg *apiConfig) unbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setBanned(w, r, false)
+}
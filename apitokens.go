@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// Scopes a personal access token can be given. chirps:write implies
+// chirps:read.
+const (
+	scopeChirpsRead   = "chirps:read"
+	scopeChirpsWrite  = "chirps:write"
+	scopeProfileWrite = "profile:write"
+)
+
+var knownScopes = []string{scopeChirpsRead, scopeChirpsWrite, scopeProfileWrite}
+
+const (
+	maxAPITokenNameLength = 100
+	maxAPITokenDays       = 365
+	apiTokenShownPrefix   = 6 // random characters kept for listing
+)
+
+var errMissingScope = errors.New("token lacks the required scope")
+
+// APIToken is a personal access token as its owner sees it. Token is only
+// ever filled in on the response that creates it.
+type APIToken struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Scopes      []string   `json:"scopes"`
+	TokenPrefix string     `json:"token_prefix"`
+	Token       string     `json:"token,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+func apiTokenFromDB(t database.ApiToken) APIToken {
+	out := APIToken{
+		ID:          t.ID,
+		Name:        t.Name,
+		Scopes:      t.Scopes,
+		TokenPrefix: t.TokenPrefix,
+		CreatedAt:   t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		out.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		out.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return out
+}
+
+func hasScope(scopes []string, want string) bool {
+	if slices.Contains(scopes, want) {
+		return true
+	}
+	return want == scopeChirpsRead && slices.Contains(scopes, scopeChirpsWrite)
+}
+
+// apiTokenUser looks up a personal access token and returns its owner, or
+// errMissingScope if it wasn't granted scope. An empty scope accepts any
+// token.
+func (cfg *apiConfig) apiTokenUser(ctx context.Context, tok, scope string) (uuid.UUID, error) {
+	t, err := cfg.lookupAPIToken(ctx, tok)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if scope != "" && !hasScope(t.Scopes, scope) {
+		return uuid.Nil, fmt.Errorf("%w %s", errMissingScope, scope)
+	}
+
+	err = cfg.Queries.TouchAPIToken(ctx, t.ID)
+	if err != nil {
+		log.Printf("Error recording API token use: %s", err)
+	}
+	return t.UserID, nil
+}
+
+// lookupAPIToken finds a personal access token that exists and hasn't
+// expired, without recording that it was used.
+func (cfg *apiConfig) lookupAPIToken(ctx context.Context, tok string) (database.GetAPITokenByHashRow, error) {
+	t, err := cfg.Queries.GetAPITokenByHash(ctx, hashToken(tok))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, errors.New("unknown API token")
+	}
+	if err != nil {
+		return t, err
+	}
+	if t.ExpiresAt.Valid && !time.Now().Before(t.ExpiresAt.Time) {
+		return t, errors.New("expired API token")
+	}
+	return t, nil
+}
+
+// authorize returns the caller on endpoints that bots may use. It accepts a
+// login's access token, which can do anything, or a personal access token
+// granted scope.
+func (cfg *apiConfig) authorize(r *http.Request, scope string) (uuid.UUID, error) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if auth.IsAPIToken(tok) {
+		return cfg.apiTokenUser(r.Context(), tok, scope)
+	}
+	return cfg.validateAccessToken(tok)
+}
+
+// respondAuthError writes a 403 for a token that is valid but not allowed
+// here, and a 401 for everything else.
+func respondAuthError(w http.ResponseWriter, err error) {
+	log.Printf("Error authenticating: %s", err)
+	if errors.Is(err, errMissingScope) {
+		respondWithJSON(w, 403, errorResponse{Error: "Forbidden: " + err.Error()})
+		return
+	}
+	respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+}
+
+// createAPITokenHandler mints a personal access token. Only a login can do
+// this, so a leaked token can't be used to make more.
+func (cfg *apiConfig) createAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// decode the request
+	var params struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// validate it
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPITokenNameLength {
+		respondWithJSON(w, 400, errorResponse{Error: fmt.Sprintf("name is required and must be at most %d characters", maxAPITokenNameLength)})
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithJSON(w, 400, errorResponse{Error: "at least one scope is required: " + strings.Join(knownScopes, ", ")})
+		return
+	}
+	for _, s := range params.Scopes {
+		if !slices.Contains(knownScopes, s) {
+			respondWithJSON(w, 400, errorResponse{Error: fmt.Sprintf("unknown scope %q; valid scopes are %s", s, strings.Join(knownScopes, ", "))})
+			return
+		}
+	}
+	scopes := slices.Compact(slices.Sorted(slices.Values(params.Scopes)))
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxAPITokenDays {
+		respondWithJSON(w, 400, errorResponse{Error: fmt.Sprintf("expires_in_days must be between 0 (never) and %d", maxAPITokenDays)})
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	// the token itself is shown once and kept only as a hash
+	tok, err := auth.MakeAPIToken()
+	if err != nil {
+		log.Printf("Error making API token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	row, err := cfg.Queries.CreateAPIToken(r.Context(), database.CreateAPITokenParams{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashToken(tok),
+		TokenPrefix: tok[:len(auth.APITokenPrefix)+apiTokenShownPrefix],
+		Scopes:      scopes,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error saving API token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	logSecurityEvent(r, "api_token_created", userID, "id=%s scopes=%s", row.ID, strings.Join(scopes, ","))
+
+	response := apiTokenFromDB(row)
+	response.Token = tok
+	respondWithJSON(w, 201, response)
+
+}
+
+func (cfg *apiConfig) listAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	rows, err := cfg.Queries.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing API tokens: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	tokens := make([]APIToken, 0, len(rows))
+	for _, t := range rows {
+		tokens = append(tokens, apiTokenFromDB(t))
+	}
+
+	respondWithJSON(w, 200, tokens)
+
+}
+
+func (cfg *apiConfig) deleteAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// parse token id
+	id, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse token id"})
+		return
+	}
+
+	// only the owner's own tokens
+	n, err := cfg.Queries.DeleteAPIToken(r.Context(), database.DeleteAPITokenParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting API token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if n == 0 {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	logSecurityEvent(r, "api_token_deleted", userID, "id=%s", id)
+
+	w.WriteHeader(204)
+
+}
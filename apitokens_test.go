@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// fakeTokenDB is an in-memory stand-in for the api_tokens table. It speaks
+// database/sql so the real generated queries run against it, but it only
+// understands the queries the token handlers use.
+type fakeTokenDB struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]*database.ApiToken
+}
+
+func (f *fakeTokenDB) Connect(context.Context) (driver.Conn, error) { return fakeTokenConn{f}, nil }
+func (f *fakeTokenDB) Driver() driver.Driver                        { return nil }
+
+// expire backdates a token's expiry, as if it had run out.
+func (f *fakeTokenDB) expire(id uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens[id].ExpiresAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+}
+
+type fakeTokenConn struct{ db *fakeTokenDB }
+
+func (c fakeTokenConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeTokenConn) Close() error                        { return nil }
+func (c fakeTokenConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+var queryName = regexp.MustCompile(`-- name: (\w+)`)
+
+func (c fakeTokenConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch name := queryName.FindStringSubmatch(query)[1]; name {
+	case "CreateAPIToken":
+		var scopes pq.StringArray
+		if err := scopes.Scan(args[4].Value); err != nil {
+			return nil, err
+		}
+		t := &database.ApiToken{
+			ID:          uuid.New(),
+			UserID:      uuid.MustParse(args[0].Value.(string)),
+			Name:        args[1].Value.(string),
+			TokenHash:   args[2].Value.(string),
+			TokenPrefix: args[3].Value.(string),
+			Scopes:      scopes,
+			CreatedAt:   time.Now(),
+		}
+		if exp, ok := args[5].Value.(time.Time); ok {
+			t.ExpiresAt = sql.NullTime{Time: exp, Valid: true}
+		}
+		f.tokens[t.ID] = t
+		return tokenRows(fullTokenColumns, t), nil
+
+	case "GetAPITokenByHash":
+		for _, t := range f.tokens {
+			if t.TokenHash == args[0].Value.(string) {
+				return tokenRows([]string{"id", "user_id", "scopes", "expires_at"}, t), nil
+			}
+		}
+		return tokenRows(nil), nil
+
+	case "ListAPITokens":
+		var out []*database.ApiToken
+		for _, t := range f.tokens {
+			if t.UserID.String() == args[0].Value.(string) {
+				out = append(out, t)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+		return tokenRows(fullTokenColumns, out...), nil
+	}
+	return nil, fmt.Errorf("fake db can't run query %q", query)
+}
+
+func (c fakeTokenConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch name := queryName.FindStringSubmatch(query)[1]; name {
+	case "TouchAPIToken":
+		if t, ok := f.tokens[uuid.MustParse(args[0].Value.(string))]; ok {
+			t.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		return driver.RowsAffected(1), nil
+
+	case "DeleteAPIToken":
+		id := uuid.MustParse(args[0].Value.(string))
+		if t, ok := f.tokens[id]; ok && t.UserID.String() == args[1].Value.(string) {
+			delete(f.tokens, id)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	}
+	return nil, fmt.Errorf("fake db can't run query %q", query)
+}
+
+var fullTokenColumns = []string{"id", "user_id", "name", "token_hash", "token_prefix", "scopes", "created_at", "expires_at", "last_used_at"}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+// tokenRows returns the named columns of tokens, encoded the way Postgres
+// would send them.
+func tokenRows(cols []string, tokens ...*database.ApiToken) *fakeRows {
+	nullTime := func(t sql.NullTime) driver.Value {
+		if !t.Valid {
+			return nil
+		}
+		return t.Time
+	}
+	out := &fakeRows{cols: cols}
+	for _, t := range tokens {
+		scopes, _ := pq.StringArray(t.Scopes).Value()
+		all := map[string]driver.Value{
+			"id":           t.ID.String(),
+			"user_id":      t.UserID.String(),
+			"name":         t.Name,
+			"token_hash":   t.TokenHash,
+			"token_prefix": t.TokenPrefix,
+			"scopes":       []byte(scopes.(string)),
+			"created_at":   t.CreatedAt,
+			"expires_at":   nullTime(t.ExpiresAt),
+			"last_used_at": nullTime(t.LastUsedAt),
+		}
+		row := make([]driver.Value, len(cols))
+		for i, c := range cols {
+			row[i] = all[c]
+		}
+		out.rows = append(out.rows, row)
+	}
+	return out
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newTokenTestServer returns the API wired to a fake token table, and an
+// access token for a signed-in user.
+func newTokenTestServer(t *testing.T) (http.Handler, *fakeTokenDB, string) {
+	h, fake, keys := newTokenTestAPI(t)
+	return h, fake, signIn(t, keys)
+}
+
+func newTokenTestAPI(t *testing.T) (http.Handler, *fakeTokenDB, *auth.KeySet) {
+	cfg, fake := newTokenTestConfig(t)
+	return routes(cfg), fake, cfg.Keys
+}
+
+func newTokenTestConfig(t *testing.T) (*apiConfig, *fakeTokenDB) {
+	t.Helper()
+	keys, err := auth.NewKeySet("", auth.NewHMACKey("", []byte("test-secret")))
+	if err != nil {
+		t.Fatalf("NewKeySet err: %v", err)
+	}
+	fake := &fakeTokenDB{tokens: map[uuid.UUID]*database.ApiToken{}}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &apiConfig{DB: db, Queries: database.New(db), Keys: keys, Denylist: newDenylist(nil)}
+	return cfg, fake
+}
+
+func signIn(t *testing.T, keys *auth.KeySet) string {
+	t.Helper()
+	login, err := keys.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT err: %v", err)
+	}
+	return login
+}
+
+func send(h http.Handler, method, path, bearer, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func createToken(t *testing.T, h http.Handler, login, body string) APIToken {
+	t.Helper()
+	w := send(h, "POST", "/api/tokens", login, body)
+	if w.Code != 201 {
+		t.Fatalf("create token: status %d, body %s", w.Code, w.Body)
+	}
+	var tok APIToken
+	if err := json.Unmarshal(w.Body.Bytes(), &tok); err != nil {
+		t.Fatalf("decoding token: %v", err)
+	}
+	return tok
+}
+
+// tooLongChirp gets past authorization on POST /api/chirps and is then
+// turned away with a 400 before anything touches the database.
+var tooLongChirp = `{"body":"` + strings.Repeat("x", 141) + `"}`
+
+func TestAPITokens_CreateListDelete(t *testing.T) {
+	h, _, keys := newTokenTestAPI(t)
+	login := signIn(t, keys)
+
+	tok := createToken(t, h, login, `{"name":"bot","scopes":["chirps:write","chirps:read","chirps:write"]}`)
+	if !strings.HasPrefix(tok.Token, auth.APITokenPrefix) || !strings.HasPrefix(tok.Token, tok.TokenPrefix) {
+		t.Fatalf("token %q doesn't start with %q", tok.Token, tok.TokenPrefix)
+	}
+	if strings.Join(tok.Scopes, " ") != "chirps:read chirps:write" {
+		t.Fatalf("scopes = %v, want sorted without duplicates", tok.Scopes)
+	}
+	if tok.ExpiresAt != nil {
+		t.Fatalf("expires_at = %v, want never", tok.ExpiresAt)
+	}
+
+	// the token works where its scope allows
+	if w := send(h, "POST", "/api/chirps", tok.Token, tooLongChirp); w.Code != 400 {
+		t.Fatalf("chirp with token: status %d, want 400 from validation", w.Code)
+	}
+
+	// listing never shows the secret again
+	w := send(h, "GET", "/api/tokens", login, "")
+	if w.Code != 200 {
+		t.Fatalf("list: status %d", w.Code)
+	}
+	var listed []APIToken
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decoding list: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != tok.ID || listed[0].Token != "" || listed[0].LastUsedAt == nil {
+		t.Fatalf("list = %+v", listed)
+	}
+
+	// another user can't delete it
+	if w := send(h, "DELETE", "/api/tokens/"+tok.ID.String(), signIn(t, keys), ""); w.Code != 404 {
+		t.Fatalf("delete by another user: status %d, want 404", w.Code)
+	}
+
+	// its owner can, and then it stops working
+	if w := send(h, "DELETE", "/api/tokens/"+tok.ID.String(), login, ""); w.Code != 204 {
+		t.Fatalf("delete: status %d, want 204", w.Code)
+	}
+	if w := send(h, "POST", "/api/chirps", tok.Token, tooLongChirp); w.Code != 401 {
+		t.Fatalf("chirp with deleted token: status %d, want 401", w.Code)
+	}
+	if w := send(h, "DELETE", "/api/tokens/"+tok.ID.String(), login, ""); w.Code != 404 {
+		t.Fatalf("second delete: status %d, want 404", w.Code)
+	}
+}
+
+func TestAPITokens_ScopeDenied(t *testing.T) {
+	h, _, login := newTokenTestServer(t)
+	tok := createToken(t, h, login, `{"name":"reader","scopes":["chirps:read"]}`)
+
+	// a real token without the scope is forbidden, an unknown one unauthorized
+	if w := send(h, "POST", "/api/chirps", tok.Token, tooLongChirp); w.Code != 403 {
+		t.Fatalf("read-only token posting: status %d, want 403", w.Code)
+	}
+	if w := send(h, "POST", "/api/chirps", auth.APITokenPrefix+"nonsense", tooLongChirp); w.Code != 401 {
+		t.Fatalf("unknown token: status %d, want 401", w.Code)
+	}
+
+	// and no token can manage tokens, whatever its scopes
+	if w := send(h, "POST", "/api/tokens", tok.Token, `{"name":"more","scopes":["chirps:write"]}`); w.Code != 401 {
+		t.Fatalf("token minting a token: status %d, want 401", w.Code)
+	}
+	if w := send(h, "GET", "/api/tokens", tok.Token, ""); w.Code != 401 {
+		t.Fatalf("token listing tokens: status %d, want 401", w.Code)
+	}
+}
+
+func TestAPITokens_Expiry(t *testing.T) {
+	h, fake, login := newTokenTestServer(t)
+
+	tok := createToken(t, h, login, `{"name":"temp","scopes":["chirps:write"],"expires_in_days":1}`)
+	if tok.ExpiresAt == nil || time.Until(*tok.ExpiresAt) < 23*time.Hour {
+		t.Fatalf("expires_at = %v, want a day from now", tok.ExpiresAt)
+	}
+	if w := send(h, "POST", "/api/chirps", tok.Token, tooLongChirp); w.Code != 400 {
+		t.Fatalf("chirp before expiry: status %d, want 400 from validation", w.Code)
+	}
+
+	fake.expire(tok.ID)
+	if w := send(h, "POST", "/api/chirps", tok.Token, tooLongChirp); w.Code != 401 {
+		t.Fatalf("chirp after expiry: status %d, want 401", w.Code)
+	}
+}
+
+func TestAPITokens_CreateValidation(t *testing.T) {
+	h, _, login := newTokenTestServer(t)
+
+	for _, body := range []string{
+		`{"name":"","scopes":["chirps:read"]}`,
+		`{"name":"` + strings.Repeat("n", maxAPITokenNameLength+1) + `","scopes":["chirps:read"]}`,
+		`{"name":"bot","scopes":[]}`,
+		`{"name":"bot","scopes":["admin"]}`,
+		`{"name":"bot","scopes":["chirps:read"],"expires_in_days":-1}`,
+		`{"name":"bot","scopes":["chirps:read"],"expires_in_days":366}`,
+	} {
+		if w := send(h, "POST", "/api/tokens", login, body); w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if w := send(h, "POST", "/api/tokens", "", `{"name":"bot","scopes":["chirps:read"]}`); w.Code != 401 {
+		t.Errorf("no login: status %d, want 401", w.Code)
+	}
+}
+
+func TestRateLimitKey_APIToken(t *testing.T) {
+	cfg, fake := newTokenTestConfig(t)
+	h := routes(cfg)
+	tok := createToken(t, h, signIn(t, cfg.Keys), `{"name":"bot","scopes":["chirps:write"]}`)
+	owner := fake.tokens[tok.ID].UserID
+	cfg.RedCache = &chirpyRedCache{entries: map[uuid.UUID]chirpyRedEntry{
+		owner: {red: false, checked: time.Now()},
+	}}
+
+	key := func(bearer string) string {
+		r := httptest.NewRequest("POST", "/api/chirps", nil)
+		r.Header.Set("Authorization", "Bearer "+bearer)
+		k, _ := cfg.rateLimitKey(r, chirpPolicy)
+		return k
+	}
+
+	// a real token counts against its owner
+	if got, want := key(tok.Token), "chirp:user:"+owner.String(); got != want {
+		t.Fatalf("valid token key = %q, want %q", got, want)
+	}
+
+	// made-up and expired tokens share the address's bucket
+	anon := "chirp:ip:192.0.2.1"
+	if got := key(auth.APITokenPrefix + "made-up"); got != anon {
+		t.Fatalf("unknown token key = %q, want %q", got, anon)
+	}
+	fake.expire(tok.ID)
+	if got := key(tok.Token); got != anon {
+		t.Fatalf("expired token key = %q, want %q", got, anon)
+	}
+}
+
+func TestRespondAuthError(t *testing.T) {
+	for err, want := range map[error]int{
+		fmt.Errorf("%w %s", errMissingScope, scopeChirpsWrite): 403,
+		errors.New("unknown API token"):                        401,
+		errors.New("token is expired"):                         401,
+	} {
+		w := httptest.NewRecorder()
+		respondAuthError(w, err)
+		if w.Code != want {
+			t.Errorf("respondAuthError(%v) = %d, want %d", err, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// optionalUserID returns the caller's id on endpoints that don't require a
+// login; a missing or invalid token just means an anonymous caller.
+func (cfg *apiConfig) optionalUserID(r *http.Request) uuid.NullUUID {
+	id, err := cfg.authorize(r, scopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}
+}
+
+// originalChirp looks up a chirp that is being replied to, quoted, liked or
+// rechirped. Rechirps stand in for the chirp they repost, and deleted chirps
+// are reported as sql.ErrNoRows.
+func (cfg *apiConfig) originalChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.Queries.GetOneChirp(ctx, id)
+	if err == nil && chirp.RechirpOf.Valid {
+		chirp, err = cfg.Queries.GetOneChirp(ctx, chirp.RechirpOf.UUID)
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+// indexChirp brings the tag and mention indexes in line with a chirp's
+// current body. Run it in the same transaction as whatever wrote the body.
+func indexChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	err := unindexChirp(ctx, q, chirp.ID)
+	if err != nil || chirp.DeletedAt.Valid {
+		return err
+	}
+
+	err = tagChirp(ctx, q, chirp)
+	if err != nil {
+		return err
+	}
+	return mentionChirp(ctx, q, chirp)
+}
+
+// unindexChirp drops a chirp from the tag and mention indexes.
+func unindexChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	err := q.UntagChirp(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+	return q.DeleteChirpMentions(ctx, chirpID)
+}
+
+// renderChirps converts chirp rows for a response, embedding the originals
+// of rechirps and quotes. viewer is the calling user, if any.
+func (cfg *apiConfig) renderChirps(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]Chirp, error) {
+
+	// originals that aren't already part of the batch
+	inBatch := make(map[uuid.UUID]bool, len(chirps))
+	for _, c := range chirps {
+		inBatch[c.ID] = true
+	}
+	var embedIDs []uuid.UUID
+	for _, c := range chirps {
+		for _, id := range []uuid.NullUUID{c.RechirpOf, c.QuoteOf} {
+			if id.Valid && !inBatch[id.UUID] {
+				inBatch[id.UUID] = true
+				embedIDs = append(embedIDs, id.UUID)
+			}
+		}
+	}
+	all := chirps[:len(chirps):len(chirps)]
+	if len(embedIDs) > 0 {
+		originals, err := cfg.Queries.GetChirpsByIDs(ctx, embedIDs)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, originals...)
+	}
+
+	rendered, err := cfg.fillChirpDetails(ctx, all, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	// attach copies of the originals
+	byID := make(map[uuid.UUID]Chirp, len(rendered))
+	for _, c := range rendered {
+		byID[c.ID] = c
+	}
+	out := rendered[:len(chirps)]
+	for i, c := range chirps {
+		if original, ok := byID[c.RechirpOf.UUID]; ok && c.RechirpOf.Valid {
+			out[i].RechirpOf = &original
+		}
+		if original, ok := byID[c.QuoteOf.UUID]; ok && c.QuoteOf.Valid {
+			out[i].QuoteOf = &original
+		}
+	}
+
+	return out, nil
+}
+
+func (cfg *apiConfig) renderChirp(ctx context.Context, chirp database.Chirp, viewer uuid.NullUUID) (Chirp, error) {
+	out, err := cfg.renderChirps(ctx, []database.Chirp{chirp}, viewer)
+	if err != nil {
+		return Chirp{}, err
+	}
+	return out[0], nil
+}
+
+// fillChirpDetails converts chirp rows and fills in per-chirp counts,
+// mentions and media, using one query per batch rather than one per chirp.
+func (cfg *apiConfig) fillChirpDetails(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]Chirp, error) {
+	out := chirpsFromDB(chirps)
+	if len(chirps) == 0 {
+		return out, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	index := make(map[uuid.UUID]int, len(chirps))
+	for i, c := range chirps {
+		ids = append(ids, c.ID)
+		index[c.ID] = i
+	}
+
+	// like counts, and whether the viewer is one of the likers
+	likes, err := cfg.Queries.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if viewer.Valid {
+		for i := range out {
+			out[i].LikedByMe = new(bool)
+		}
+	}
+	for _, l := range likes {
+		i := index[l.ChirpID]
+		out[i].LikeCount = l.LikeCount
+		if viewer.Valid {
+			*out[i].LikedByMe = l.LikedByMe
+		}
+	}
+
+	// rechirp counts
+	rechirps, err := cfg.Queries.GetRechirpCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range rechirps {
+		out[index[rc.ChirpID.UUID]].RechirpCount = rc.RechirpCount
+	}
+
+	// mentioned users
+	mentions, err := cfg.Queries.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mentions {
+		i := index[m.ChirpID]
+		out[i].Mentions = append(out[i].Mentions, Mention{
+			UserID:   m.UserID,
+			Username: m.Username.String,
+			Start:    int(m.StartOffset),
+			End:      int(m.EndOffset),
+		})
+	}
+
+	// attached media
+	media, err := cfg.Queries.GetChirpMedia(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range media {
+		i := index[m.ChirpID]
+		out[i].Media = append(out[i].Media, Attachment{
+			Media:   mediaFromDB(m.MediaFile),
+			AltText: m.AltText,
+		})
+	}
+
+	return out, nil
+}
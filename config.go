@@ -7,22 +7,39 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/blob"
 	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/mailer"
+	"github.com/jonathangibson/chirpy/internal/password"
+	"github.com/jonathangibson/chirpy/internal/ratelimit"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	Queries        *database.Queries // go
+	DB             *sql.DB
+	Denylist       *denylist
 	Platform       string
-	Secret         string
+	Keys           *auth.KeySet
 	ApiKey         string
+	AdminKey       string
+	Blobs          blob.Store
+	Mailer         mailer.Mailer
+	Lockouts       *loginLockouts
+	Passwords      *password.Checker
+	RateLimits     ratelimit.Store // nil turns rate limiting off
+	RedCache       *chirpyRedCache
+	BaseURL        string // public origin for links in email
+
+	// RequireVerifiedEmail stops users posting chirps until they've
+	// confirmed their email address.
+	RequireVerifiedEmail bool
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -36,6 +53,31 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// authenticatedUserID returns the id of the user named by the request's bearer token.
+// Only a login's access token will do; endpoints open to personal access
+// tokens use authorize instead.
+func (cfg *apiConfig) authenticatedUserID(r *http.Request) (uuid.UUID, error) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return cfg.validateAccessToken(tok)
+}
+
+// validateAccessToken checks an access token's signature and expiry and that
+// it hasn't been revoked, and returns the user it belongs to. Every
+// authenticated endpoint goes through here.
+func (cfg *apiConfig) validateAccessToken(tok string) (uuid.UUID, error) {
+	claims, err := cfg.Keys.ParseJWT(tok)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if claims.TokenID != uuid.Nil && cfg.Denylist.isRevoked(claims.TokenID) {
+		return uuid.Nil, errors.New("token has been revoked")
+	}
+	return claims.UserID, nil
+}
+
 func (cfg *apiConfig) writeNumberOfRequests(w http.ResponseWriter, r *http.Request) {
 
 	// load the current hit count from an atomic.Int32 struct (a special wrapper whose Load method protects against race conditions)
@@ -60,6 +102,7 @@ func (cfg *apiConfig) addUserHandler(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Username string `json:"username"`
 	}
 
 	// decode the request body
@@ -80,6 +123,22 @@ func (cfg *apiConfig) addUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// username is optional, but must be valid if given
+	var username sql.NullString
+	if params.Username != "" {
+		err = validateUsername(params.Username)
+		if err != nil {
+			respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+			return
+		}
+		username = sql.NullString{String: params.Username, Valid: true}
+	}
+
+	// the password has to meet the policy
+	if !cfg.acceptablePassword(w, pwd, email, params.Username) {
+		return
+	}
+
 	// hash password
 	hashPass, err := auth.HashPassword(pwd)
 	if err != nil {
@@ -92,23 +151,41 @@ func (cfg *apiConfig) addUserHandler(w http.ResponseWriter, r *http.Request) {
 	dbParams := database.CreateUserParams{
 		Email:          params.Email,
 		HashedPassword: hashPass,
+		Username:       username,
 	}
 
 	// add a user row
 	user, err := cfg.Queries.CreateUser(r.Context(), dbParams)
+	if isUsernameTaken(err) {
+		respondWithJSON(w, 409, errorResponse{Error: "username is taken"})
+		return
+	}
+	if isEmailTaken(err) {
+		respondWithJSON(w, 409, errorResponse{Error: "email is taken"})
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating user: %s", err)
 		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
 		return
 	}
 
+	// ask the user to confirm the address
+	err = cfg.sendVerificationEmail(user.ID, user.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	// struct for response body
 	responseUser := User{
-		ID:         user.ID,
-		CreatedAt:  user.CreatedAt,
-		UpdatedAt:  user.UpdatedAt,
-		Email:      user.Email,
-		IsUpgraded: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		Username:      nullStringPtr(user.Username),
+		IsUpgraded:    user.IsChirpyRed,
 	}
 
 	// success msg
@@ -165,58 +242,71 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// lookup user by email
+	// locked out callers don't get to guess at all
 	email := strings.TrimSpace(params.Email)
+	ip := clientIP(r)
+	if wait := cfg.Lockouts.reserve(email, ip); wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+
+	// lookup user by email; an unknown one still costs a hash comparison
+	pwd := strings.TrimSpace(params.Password)
 	user, err := cfg.Queries.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		log.Printf("Error locating user: %s", err)
-		respondWithJSON(w, 401, errorResponse{Error: "Incorrect email or password"})
-		return
+		auth.CheckPasswordHash(pwd, dummyPasswordHash())
 	}
 
 	// compare password hashes
-	pwd := strings.TrimSpace(params.Password)
-	match, err := auth.CheckPasswordHash(pwd, user.HashedPassword)
+	match := false
+	if err == nil {
+		match, err = auth.CheckPasswordHash(pwd, user.HashedPassword)
+	}
 	if !match || err != nil {
 		log.Printf("Password mismatch or error")
+		if wait := cfg.Lockouts.fail(email, ip); wait > 0 {
+			logSecurityEvent(r, "login_locked", user.ID, "email=%q for %s", email, wait)
+		}
 		respondWithJSON(w, 401, errorResponse{Error: "Incorrect email or password"})
 		return
 	}
+	cfg.Lockouts.succeed(email, ip)
 
-	// create user for response
-	responseUser := User{
-		ID:         user.ID,
-		CreatedAt:  user.CreatedAt,
-		UpdatedAt:  user.UpdatedAt,
-		Email:      user.Email,
-		IsUpgraded: user.IsChirpyRed,
-	}
+	// bring hashes made with older, cheaper settings up to date
+	cfg.upgradePasswordHash(r.Context(), user.ID, pwd, user.HashedPassword)
 
-	// create a json web token
-	tok, err := auth.MakeJWT(user.ID, cfg.Secret, time.Duration(time.Hour))
-	if err != nil {
-		log.Printf("error: %s", err)
-		respondWithJSON(w, 500, responseUser)
+	// banned users keep their account but can't sign in
+	if user.BannedAt.Valid {
+		respondWithJSON(w, 403, errorResponse{Error: "Account is suspended"})
 		return
 	}
 
-	// create a refresh token
-	refreshTok, err := auth.MakeRefreshToken()
-	if err != nil {
-		log.Printf("error: %s", err)
-		respondWithJSON(w, 500, responseUser)
+	// create user for response
+	responseUser := User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		Username:      nullStringPtr(user.Username),
+		IsUpgraded:    user.IsChirpyRed,
+	}
+
+	// with 2FA on, the password only earns a challenge, and not while the
+	// account is locked out for wrong codes
+	if user.TotpEnabledAt.Valid {
+		if wait := cfg.Lockouts.checkCode(user.ID); wait > 0 {
+			respondLockedOut(w, wait)
+			return
+		}
+		cfg.respondWithLoginChallenge(w, r, user.ID)
 		return
 	}
 
-	// store refresh token in the database
-	_, err = cfg.Queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshTok,
-		UserID: user.ID,
-		ExpiresAt: sql.NullTime{
-			Time:  time.Now().Add(60 * 24 * time.Hour),
-			Valid: true,
-		},
-	})
+	// create the access and refresh tokens
+	tok, refreshTok, err := cfg.startSession(r, user.ID)
 	if err != nil {
 		log.Printf("error: %s", err)
 		respondWithJSON(w, 500, responseUser)
@@ -235,16 +325,18 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// authenticate the user
-	tok, err := auth.GetBearerToken(r.Header)
+	tokenId, err := cfg.authorize(r, scopeChirpsWrite)
 	if err != nil {
-		log.Printf("bearer token not found")
-		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		respondAuthError(w, err)
 		return
 	}
 
 	// struct for decoding body
 	type createChirpDTO struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
+		Media     []mediaRef `json:"media"`
 	}
 	var dto createChirpDTO
 
@@ -261,36 +353,121 @@ func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check for authorization
-	tokenId, err := auth.ValidateJWT(tok, cfg.Secret)
+	// operators may insist on a confirmed email first
+	if !cfg.requireVerifiedEmail(w, r, tokenId) {
+		return
+	}
+
+	// replies must point at a chirp that still exists
+	var inReplyTo uuid.NullUUID
+	if dto.InReplyTo != nil {
+		parent, err := cfg.originalChirp(r.Context(), *dto.InReplyTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithJSON(w, 404, errorResponse{Error: "Chirp being replied to not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching parent chirp: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	// and so must quotes
+	var quoteOf uuid.NullUUID
+	if dto.QuoteOf != nil {
+		quoted, err := cfg.originalChirp(r.Context(), *dto.QuoteOf)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithJSON(w, 404, errorResponse{Error: "Quoted chirp not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching quoted chirp: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	// attachments must be the caller's own uploads
+	attachments, err := parseMediaRefs(dto.Media)
 	if err != nil {
-		log.Printf("Error validating token: %s", err.Error())
-		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
 		return
 	}
+	for _, id := range attachments.MediaIds {
+		err = cfg.ownMedia(r.Context(), tokenId, id)
+		if errors.Is(err, errNotOwnMedia) {
+			respondWithJSON(w, 400, errorResponse{Error: "Attached media not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking attached media: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+			return
+		}
+	}
 
 	// params for adding chirp
 	params := database.CreateChirpParams{
-		Body:   stripProfane(dto.Body),
-		UserID: tokenId,
+		Body:      stripProfane(dto.Body),
+		UserID:    tokenId,
+		InReplyTo: inReplyTo,
+		QuoteOf:   quoteOf,
 	}
 
-	// add the chirp
-	chirp, err := cfg.Queries.CreateChirp(r.Context(), params)
+	// add the chirp, index its tags and attach its media together
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(r.Context(), params)
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
 		respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
 		return
 	}
 
+	err = indexChirp(r.Context(), qtx, chirp)
+	if err != nil {
+		log.Printf("Error indexing chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+		return
+	}
+
+	if len(attachments.MediaIds) > 0 {
+		attachments.ChirpID = chirp.ID
+		err = qtx.AttachChirpMedia(r.Context(), attachments)
+		if err != nil {
+			log.Printf("Error attaching media: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Error creating chirp"})
+		return
+	}
+
+	// render the new chirp
+	response, err := cfg.renderChirp(r.Context(), chirp, uuid.NullUUID{UUID: tokenId, Valid: true})
+	if err != nil {
+		log.Printf("Error rendering chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
 	// success response
-	respondWithJSON(w, 201, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	respondWithJSON(w, 201, response)
 
 }
 
@@ -300,10 +477,8 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("author_id")
 	sortStr := r.URL.Query().Get("sort")
 
-	var chirps []database.Chirp
-	var err error
-
 	// id specified?
+	var authorID uuid.NullUUID
 	if idStr != "" {
 		id, err := uuid.Parse(idStr)
 		if err != nil {
@@ -311,41 +486,63 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 			respondWithJSON(w, 401, "Invalid user id")
 			return
 		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
 
-		// get user's chirps if so
-		chirps, err = cfg.Queries.GetUserChirps(r.Context(), id)
-		if err != nil {
-			respondWithJSON(w, 500, errorResponse{Error: err.Error()})
-			return
-		}
-	} else { // otherwise get all chirps
-		chirps, err = cfg.Queries.GetAllChirps(r.Context())
-		if err != nil {
-			respondWithJSON(w, 500, errorResponse{Error: err.Error()})
-			return
-		}
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
 	}
 
-	chirpSlice := make([]Chirp, 0, len(chirps))
+	// a cursor only continues the ordering it was issued for
+	desc := sortStr == "desc"
+	if cur != nil && cur.Desc != desc {
+		respondWithJSON(w, 400, errorResponse{Error: "cursor does not match sort order"})
+		return
+	}
 
-	// prepare struct for response
-	for _, c := range chirps {
-		chirpSlice = append(chirpSlice, Chirp{
-			ID:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserId:    c.UserID,
+	// ascending pages read forward with the ascending query, descending ones with the descending query
+	chirps, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.Chirp, error) {
+		if forward != desc {
+			return cfg.Queries.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+				AuthorID:        authorID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		return cfg.Queries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
 		})
+	}, func(c database.Chirp) pageCursor {
+		k := chirpCursor(c)
+		k.Desc = desc
+		return k
+	})
+	if err != nil {
+		log.Printf("Error listing chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
 	}
 
-	// sorting
-	if sortStr == "desc" {
-		sort.Slice(chirpSlice, func(i, j int) bool { return chirpSlice[i].CreatedAt.After(chirpSlice[j].CreatedAt) })
+	// fill in counts and the caller's likes
+	chirpSlice, err := cfg.renderChirps(r.Context(), chirps, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
 	}
 
-	// response body with chirps
-	respondWithJSON(w, 200, chirpSlice)
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirpSlice,
+		Next:   next,
+		Prev:   prev,
+	})
 
 }
 
@@ -361,7 +558,7 @@ func (cfg *apiConfig) getOneChirpHandler(w http.ResponseWriter, r *http.Request)
 
 	// retrieve chirp from database
 	chirp, err := cfg.Queries.GetOneChirp(r.Context(), chirpID)
-	if errors.Is(err, sql.ErrNoRows) {
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirp.DeletedAt.Valid) {
 		respondWithJSON(w, 404, errorResponse{Error: "not found"})
 		return
 	}
@@ -370,17 +567,23 @@ func (cfg *apiConfig) getOneChirpHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// fill in counts and the caller's likes
+	response, err := cfg.renderChirp(r.Context(), chirp, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
 	// return json body with chirp struct
-	respondWithJSON(w, 200, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	respondWithJSON(w, 200, response)
 
 }
 
+// refreshHandler swaps a refresh token for a new access token and a new
+// refresh token. Each refresh token works once: presenting one that has
+// already been rotated out means two parties hold it, so the whole family
+// descended from that login is revoked.
 func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	// obtain refresh token from request
@@ -391,24 +594,109 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// retrieve user id from refresh token in database
-	user, err := cfg.Queries.GetUserFromRefreshToken(r.Context(), tok)
+	// look the refresh token up
+	old, err := cfg.Queries.GetRefreshToken(r.Context(), tok)
 	if err != nil {
 		log.Printf("refresh token lookup failed")
 		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
 		return
 	}
 
-	// create a new json web token
-	newTok, err := auth.MakeJWT(user.ID, cfg.Secret, time.Duration(time.Hour))
+	// dead sessions just fail
+	if old.RevokedAt.Valid || !old.ExpiresAt.Valid || old.ExpiresAt.Time.Before(time.Now()) {
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// but a rotated-out token from a live session coming back is a replay
+	if old.RotatedAt.Valid {
+		cfg.revokeFamily(r, old, "a rotated refresh token was presented again")
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// create the replacement refresh token
+	newRefresh, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// create a new json web token, tied to the session so it can be revoked
+	// with it
+	newTok, claims, err := cfg.Keys.Issue(old.UserID, time.Duration(time.Hour))
 	if err != nil {
 		log.Printf("error: %s", err)
 		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
 		return
 	}
 
+	// retire the old token and store the new one together
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	// only one caller can rotate a token; losing the race is also a replay
+	rotated, err := qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      old.Token,
+		ReplacedBy: sql.NullString{String: newRefresh, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error rotating refresh token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if rotated == 0 {
+		tx.Rollback()
+		cfg.revokeFamily(r, old, "a refresh token was used twice at once")
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:  newRefresh,
+		UserID: old.UserID,
+		ExpiresAt: sql.NullTime{
+			Time:  time.Now().Add(refreshTokenTTL),
+			Valid: true,
+		},
+		FamilyID:        old.FamilyID,
+		UserAgent:       userAgent(r),
+		IpAddress:       clientIP(r),
+		AccessJti:       uuid.NullUUID{UUID: claims.TokenID, Valid: true},
+		AccessExpiresAt: sql.NullTime{Time: claims.ExpiresAt, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error creating refresh token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing refresh token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
 	// send success msg
-	respondWithJSON(w, 200, map[string]string{"token": newTok})
+	respondWithJSON(w, 200, map[string]string{"token": newTok, "refresh_token": newRefresh})
+}
+
+// revokeFamily revokes every refresh token descended from the same login as
+// tok and records why.
+func (cfg *apiConfig) revokeFamily(r *http.Request, tok database.RefreshToken, reason string) {
+	logSecurityEvent(r, "refresh_token_reuse", tok.UserID, "family=%s: %s; revoking family", tok.FamilyID, reason)
+	err := cfg.endSession(r.Context(), tok.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking refresh token family %s: %s", tok.FamilyID, err)
+	}
 }
 
 func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
@@ -421,14 +709,22 @@ func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// revoke refresh token
-	err = cfg.Queries.RevokeRefreshToken(r.Context(), tok)
+	// find the session the refresh token belongs to
+	refresh, err := cfg.Queries.GetRefreshToken(r.Context(), tok)
 	if err != nil {
 		log.Printf("could not retrieve refresh token")
 		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
 		return
 	}
 
+	// end it, access tokens included
+	err = cfg.endSession(r.Context(), refresh.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
 	// success header
 	w.WriteHeader(204)
 
@@ -438,8 +734,9 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	// struct to receive credentials
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string  `json:"email"`
+		Password string  `json:"password"`
+		Username *string `json:"username"`
 	}
 
 	// decode credentials
@@ -459,7 +756,7 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request)
 		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
 		return
 	}
-	userId, err := auth.ValidateJWT(tok, cfg.Secret)
+	userId, err := cfg.validateAccessToken(tok)
 	if err != nil {
 		log.Printf("Error validating token: %s", err.Error())
 		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
@@ -474,28 +771,149 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// hash password for storage
-	hashPass, err := auth.HashPassword(pwd)
+	// a new username must be valid; leaving it out keeps the current one
+	if params.Username != nil {
+		err = validateUsername(*params.Username)
+		if err != nil {
+			respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	// note whether the password is actually changing
+	oldHash, err := cfg.Queries.GetUserPasswordHash(r.Context(), userId)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
+		log.Printf("Error getting password hash: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	samePassword, err := auth.CheckPasswordHash(pwd, oldHash)
+	if err != nil {
+		log.Printf("Error checking password: %s", err)
 		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
 		return
 	}
 
-	// params to call user update
-	dbParams := database.UpdateUserParams{
-		Email:          email,
-		HashedPassword: hashPass,
-		ID:             userId,
+	current, err := cfg.Queries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
 	}
 
-	// update the user
-	err = cfg.Queries.UpdateUser(r.Context(), dbParams)
+	// judge a new password against the username the account will have
+	username := current.Username.String
+	if params.Username != nil {
+		username = *params.Username
+	}
+	if !samePassword && !cfg.acceptablePassword(w, pwd, email, username) {
+		return
+	}
+
+	// a new email only takes over once the user proves they own it
+	pending := sql.NullString{}
+	if email != current.Email {
+		pending = sql.NullString{String: email, Valid: true}
+	}
+
+	// hash a new password before taking any locks; it is slow on purpose
+	var hashPass string
+	if !samePassword {
+		hashPass, err = auth.HashPassword(pwd)
+		if err != nil {
+			log.Printf("Error hashing password: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	// apply every change or none of them
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("Error updating user: %s", err)
+		log.Printf("Error starting transaction: %s", err)
 		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	// a taken username leaves the user untouched
+	if params.Username != nil {
+		err = qtx.SetUsername(r.Context(), database.SetUsernameParams{
+			ID:       userId,
+			Username: sql.NullString{String: *params.Username, Valid: true},
+		})
+		if isUsernameTaken(err) {
+			respondWithJSON(w, 409, errorResponse{Error: "username is taken"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating username: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	// hold the email change, or drop one the user has gone back on
+	pendingChanged := pending != current.PendingEmail
+	if pendingChanged {
+		err = qtx.SetPendingEmail(r.Context(), database.SetPendingEmailParams{
+			ID:           userId,
+			PendingEmail: pending,
+		})
+		if err != nil {
+			log.Printf("Error setting pending email: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	var revoked accessTokens
+	if !samePassword {
+		err = qtx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+			ID:             userId,
+			HashedPassword: hashPass,
+		})
+		if err != nil {
+			log.Printf("Error updating password: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+
+		// tokens handed out under the old password go with it
+		err = qtx.DeleteAPITokensForUser(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error deleting API tokens: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+
+		// and so does every session
+		revoked, err = revokeAllSessions(r.Context(), qtx, userId)
+		if err != nil {
+			log.Printf("Error revoking sessions: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing user update: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// the revoked access tokens stop working here at once
+	cfg.Denylist.remember(revoked)
+
+	// only now that it's saved, ask the user to confirm the new address
+	if pendingChanged && pending.Valid {
+		err = cfg.sendVerificationEmail(userId, email)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}
 
 	// retrieve updated user
 	user, err := cfg.Queries.GetUserByID(r.Context(), userId)
@@ -507,11 +925,14 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	// struct for response
 	responseUser := User{
-		ID:         user.ID,
-		CreatedAt:  user.CreatedAt,
-		UpdatedAt:  user.UpdatedAt,
-		Email:      user.Email,
-		IsUpgraded: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		Username:      nullStringPtr(user.Username),
+		IsUpgraded:    user.IsChirpyRed,
 	}
 
 	// success response
@@ -530,22 +951,15 @@ func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// authenticate user
-	tok, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("bearer token not found")
-		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
-		return
-	}
-	userId, err := auth.ValidateJWT(tok, cfg.Secret)
+	userId, err := cfg.authorize(r, scopeChirpsWrite)
 	if err != nil {
-		log.Printf("Error validating token: %s", err.Error())
-		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		respondAuthError(w, err)
 		return
 	}
 
 	// fetch chirp
 	chirp, err := cfg.Queries.GetOneChirp(r.Context(), chirpID)
-	if errors.Is(err, sql.ErrNoRows) {
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirp.DeletedAt.Valid) {
 		respondWithJSON(w, 404, errorResponse{Error: "not found"})
 		return
 	}
@@ -561,8 +975,8 @@ func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// delete chirps from the database
-	err = cfg.Queries.DeleteChirp(r.Context(), chirp.ID)
+	// delete the chirp, leaving a tombstone if it has replies
+	err = cfg.removeChirp(r.Context(), chirp.ID)
 	if err != nil {
 		log.Printf("Error deleting chirp: %s", err.Error())
 		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
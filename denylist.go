@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// denylistSyncInterval is how often each server reloads revocations from
+// the database. Revocations made on this server apply at once; ones made on
+// another server apply within this interval.
+const denylistSyncInterval = 15 * time.Second
+
+// denylist is the set of access tokens, by jti, that were revoked before
+// they expired. Postgres is the source of truth; every check is served from
+// memory.
+type denylist struct {
+	q *database.Queries
+
+	mu      sync.RWMutex
+	revoked map[uuid.UUID]time.Time // jti to expiry
+}
+
+func newDenylist(q *database.Queries) *denylist {
+	return &denylist{q: q, revoked: map[uuid.UUID]time.Time{}}
+}
+
+// isRevoked reports whether the token with this jti was revoked.
+func (d *denylist) isRevoked(jti uuid.UUID) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.revoked[jti]
+	return ok
+}
+
+// accessTokens collects the access tokens issued alongside refresh tokens
+// that are being revoked. Tokens that have already expired are skipped.
+type accessTokens struct {
+	jtis       []uuid.UUID
+	expiresAts []time.Time
+}
+
+func (a *accessTokens) add(jti uuid.NullUUID, expiresAt sql.NullTime) {
+	if !jti.Valid || !expiresAt.Valid || expiresAt.Time.Before(time.Now()) {
+		return
+	}
+	a.jtis = append(a.jtis, jti.UUID)
+	a.expiresAts = append(a.expiresAts, expiresAt.Time)
+}
+
+// revoke records the tokens in the database and then in memory.
+func (d *denylist) revoke(ctx context.Context, toks accessTokens) error {
+	err := recordRevoked(ctx, d.q, toks)
+	if err != nil {
+		return err
+	}
+	d.remember(toks)
+	return nil
+}
+
+// recordRevoked writes the tokens to the database through q, which may be
+// part of a transaction. Call remember once that transaction commits.
+func recordRevoked(ctx context.Context, q *database.Queries, toks accessTokens) error {
+	if len(toks.jtis) == 0 {
+		return nil
+	}
+	return q.RevokeAccessTokens(ctx, database.RevokeAccessTokensParams{
+		Jtis:       toks.jtis,
+		ExpiresAts: toks.expiresAts,
+	})
+}
+
+// remember adds tokens already recorded in the database to memory.
+func (d *denylist) remember(toks accessTokens) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, jti := range toks.jtis {
+		d.revoked[jti] = toks.expiresAts[i]
+	}
+}
+
+// sync merges in revocations made by other servers and drops entries for
+// tokens that have expired anyway. Entries are never removed any other way,
+// so merging can't lose a revocation made here while the query ran.
+func (d *denylist) sync(ctx context.Context) error {
+	err := d.q.DeleteExpiredRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := d.q.ListRevokedAccessTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[uuid.UUID]time.Time, len(rows))
+	for _, row := range rows {
+		revoked[row.Jti] = row.ExpiresAt
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for jti, expiresAt := range d.revoked {
+		if expiresAt.After(now) {
+			revoked[jti] = expiresAt
+		}
+	}
+	d.revoked = revoked
+	return nil
+}
+
+// run calls sync every interval until ctx is done.
+func (d *denylist) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.sync(ctx); err != nil {
+				log.Printf("Error syncing token denylist: %s", err)
+			}
+		}
+	}
+}
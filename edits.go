@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// ChirpRevision is an earlier body of an edited chirp, along with when it
+// was replaced.
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type chirpHistory struct {
+	Chirp     Chirp           `json:"chirp"`
+	Revisions []ChirpRevision `json:"revisions"`
+}
+
+func (cfg *apiConfig) editChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	// parse chirp id
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// editing is posting new text
+	if !cfg.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	// decode the new body
+	type editChirpDTO struct {
+		Body string `json:"body"`
+	}
+	var dto editChirpDTO
+	err = json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// validate chirp length
+	if len(dto.Body) > 140 {
+		respondWithJSON(w, 400, errorResponse{Error: "Chirp is too long"})
+		return
+	}
+	body := stripProfane(dto.Body)
+
+	// lock the chirp so concurrent edits each record a revision
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirp.DeletedAt.Valid) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// check author
+	if chirp.UserID != userID {
+		log.Printf("User id %s unauthorized to edit chirp id %s", userID, chirpID)
+		respondWithJSON(w, 403, errorResponse{Error: "Forbidden"})
+		return
+	}
+	if chirp.RechirpOf.Valid {
+		respondWithJSON(w, 400, errorResponse{Error: "Rechirps can't be edited"})
+		return
+	}
+
+	// keep the old body and store the new one, unless nothing changed
+	if body != chirp.Body {
+		err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+			ChirpID: chirp.ID,
+			Body:    chirp.Body,
+		})
+		if err != nil {
+			log.Printf("Error saving chirp revision: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+
+		chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			ID:   chirp.ID,
+			Body: body,
+		})
+		if err != nil {
+			log.Printf("Error updating chirp: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+
+		err = indexChirp(r.Context(), qtx, chirp)
+		if err != nil {
+			log.Printf("Error indexing chirp: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing chirp edit: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// render the edited chirp
+	response, err := cfg.renderChirp(r.Context(), chirp, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Error rendering chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, response)
+
+}
+
+func (cfg *apiConfig) chirpHistoryHandler(w http.ResponseWriter, r *http.Request) {
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// retrieve chirp from database
+	chirp, err := cfg.Queries.GetOneChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirp.DeletedAt.Valid) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// earlier bodies, most recently replaced first
+	revisions, err := cfg.Queries.ListChirpRevisions(r.Context(), chirp.ID)
+	if err != nil {
+		log.Printf("Error listing chirp revisions: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	response, err := cfg.renderChirp(r.Context(), chirp, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	history := chirpHistory{
+		Chirp:     response,
+		Revisions: make([]ChirpRevision, 0, len(revisions)),
+	}
+	for _, rev := range revisions {
+		history.Revisions = append(history.Revisions, ChirpRevision{
+			ID:         rev.ID,
+			Body:       rev.Body,
+			ReplacedAt: rev.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, 200, history)
+
+}
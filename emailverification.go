@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/mailer"
+)
+
+const emailTokenTTL = 24 * time.Hour
+
+// sendVerificationEmail mails a signed link that proves userID can read mail
+// sent to email.
+func (cfg *apiConfig) sendVerificationEmail(userID uuid.UUID, email string) error {
+	tok, err := cfg.Keys.IssueEmailToken(userID, email, emailTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := cfg.BaseURL + "/api/users/verify-email?token=" + url.QueryEscape(tok)
+
+	cfg.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf("Open this link within the next 24 hours to confirm %s for your Chirpy account:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n", email, link),
+	})
+	return nil
+}
+
+// emailVerified reports whether userID has confirmed their current address.
+func (cfg *apiConfig) emailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user, err := cfg.Queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerifiedAt.Valid, nil
+}
+
+// requireVerifiedEmail writes a 403 if the operator insists on a confirmed
+// email before posting and userID hasn't confirmed theirs.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	if !cfg.RequireVerifiedEmail {
+		return true
+	}
+	verified, err := cfg.emailVerified(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error checking email verification: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return false
+	}
+	if !verified {
+		respondWithJSON(w, 403, errorResponse{Error: "Verify your email address before posting"})
+		return false
+	}
+	return true
+}
+
+// verifyEmailHandler is the target of the link in the verification email. It
+// either confirms the current address or swaps in a pending one.
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+
+	// check the signed token
+	userID, email, err := cfg.Keys.ParseEmailToken(r.URL.Query().Get("token"))
+	if err != nil {
+		log.Printf("Error parsing email token: %s", err)
+		respondWithJSON(w, 400, errorResponse{Error: "Verification link is invalid or has expired"})
+		return
+	}
+
+	// a pending change takes effect now
+	n, err := cfg.Queries.ConfirmPendingEmail(r.Context(), database.ConfirmPendingEmailParams{
+		ID:    userID,
+		Email: sql.NullString{String: email, Valid: true},
+	})
+	if isEmailTaken(err) {
+		respondWithJSON(w, 409, errorResponse{Error: "email is taken"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error confirming email: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// otherwise it's the address the user already has
+	if n == 0 {
+		n, err = cfg.Queries.VerifyEmail(r.Context(), database.VerifyEmailParams{
+			ID:    userID,
+			Email: email,
+		})
+		if err != nil {
+			log.Printf("Error verifying email: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	// the user has since moved to a different address
+	if n == 0 {
+		respondWithJSON(w, 400, errorResponse{Error: "Verification link is invalid or has expired"})
+		return
+	}
+
+	respondWithJSON(w, 200, map[string]any{"email": email, "email_verified": true})
+
+}
+
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// a pending change is what needs confirming, if there is one
+	user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	email := user.PendingEmail.String
+	if !user.PendingEmail.Valid {
+		if user.EmailVerifiedAt.Valid {
+			respondWithJSON(w, 409, errorResponse{Error: "Email is already verified"})
+			return
+		}
+		email = user.Email
+	}
+
+	err = cfg.sendVerificationEmail(userID, email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(202)
+
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+type followEntry struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"followed_at"`
+}
+
+type followPage struct {
+	Users []followEntry `json:"users"`
+	Next  *string       `json:"next"`
+	Prev  *string       `json:"prev"`
+}
+
+// followTarget parses the userID path value and makes sure that user exists,
+// writing an error response if not.
+func (cfg *apiConfig) followTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse user id"})
+		return uuid.Nil, false
+	}
+
+	_, err = cfg.Queries.GetUserByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return uuid.Nil, false
+	}
+	if err != nil {
+		log.Printf("Error looking up user: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+func (cfg *apiConfig) followHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// who to follow
+	targetID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	if targetID == userID {
+		respondWithJSON(w, 400, errorResponse{Error: "You cannot follow yourself"})
+		return
+	}
+
+	// following twice is a no-op
+	_, err = cfg.Queries.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error creating follow: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
+
+func (cfg *apiConfig) unfollowHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// who to unfollow
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse user id"})
+		return
+	}
+
+	// unfollowing someone you don't follow is a no-op
+	_, err = cfg.Queries.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error deleting follow: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
+
+func (cfg *apiConfig) followersHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, func(userID uuid.UUID, cur *pageCursor, forward bool, limit int32) ([]followEntry, error) {
+		var entries []followEntry
+		if forward {
+			rows, err := cfg.Queries.ListFollowersDesc(r.Context(), database.ListFollowersDescParams{
+				UserID:          userID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+			for _, row := range rows {
+				entries = append(entries, followEntry(row))
+			}
+			return entries, err
+		}
+		rows, err := cfg.Queries.ListFollowersAsc(r.Context(), database.ListFollowersAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+		for _, row := range rows {
+			entries = append(entries, followEntry(row))
+		}
+		return entries, err
+	})
+}
+
+func (cfg *apiConfig) followingHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, func(userID uuid.UUID, cur *pageCursor, forward bool, limit int32) ([]followEntry, error) {
+		var entries []followEntry
+		if forward {
+			rows, err := cfg.Queries.ListFollowingDesc(r.Context(), database.ListFollowingDescParams{
+				UserID:          userID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+			for _, row := range rows {
+				entries = append(entries, followEntry(row))
+			}
+			return entries, err
+		}
+		rows, err := cfg.Queries.ListFollowingAsc(r.Context(), database.ListFollowingAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+		for _, row := range rows {
+			entries = append(entries, followEntry(row))
+		}
+		return entries, err
+	})
+}
+
+// listFollows writes one page of a user's follow relationships, newest first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, fetch func(userID uuid.UUID, cur *pageCursor, forward bool, limit int32) ([]followEntry, error)) {
+
+	// whose follows
+	userID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	entries, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]followEntry, error) {
+		return fetch(userID, cur, forward, limit)
+	}, func(e followEntry) pageCursor {
+		return pageCursor{CreatedAt: e.CreatedAt, ID: e.UserID}
+	})
+	if err != nil {
+		log.Printf("Error listing follows: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	if entries == nil {
+		entries = []followEntry{}
+	}
+	respondWithJSON(w, 200, followPage{
+		Users: entries,
+		Next:  next,
+		Prev:  prev,
+	})
+
+}
+
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsRead)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// newest first
+	chirps, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.Chirp, error) {
+		if forward {
+			return cfg.Queries.ListTimelineDesc(r.Context(), database.ListTimelineDescParams{
+				UserID:          userID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		return cfg.Queries.ListTimelineAsc(r.Context(), database.ListTimelineAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+	}, chirpCursor)
+	if err != nil {
+		log.Printf("Error listing timeline: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// fill in counts and the caller's likes
+	chirpSlice, err := cfg.renderChirps(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirpSlice,
+		Next:   next,
+		Prev:   prev,
+	})
+
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/entities"
+)
+
+// tagChirp adds a live chirp's #tags to the tag index.
+func tagChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	tags := entities.Hashtags(chirp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	err := q.UpsertHashtags(ctx, tags)
+	if err != nil {
+		return err
+	}
+	return q.TagChirp(ctx, database.TagChirpParams{
+		ChirpID: chirp.ID,
+		Names:   tags,
+	})
+}
+
+func (cfg *apiConfig) tagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// tags are stored lowercased and without the #
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithJSON(w, 400, errorResponse{Error: "tag is required"})
+		return
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// newest first
+	chirps, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.Chirp, error) {
+		if forward {
+			return cfg.Queries.ListTagChirpsDesc(r.Context(), database.ListTagChirpsDescParams{
+				Tag:             tag,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		return cfg.Queries.ListTagChirpsAsc(r.Context(), database.ListTagChirpsAscParams{
+			Tag:             tag,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+	}, chirpCursor)
+	if err != nil {
+		log.Printf("Error listing tagged chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// fill in counts and the caller's likes
+	chirpSlice, err := cfg.renderChirps(r.Context(), chirps, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirpSlice,
+		Next:   next,
+		Prev:   prev,
+	})
+
+}
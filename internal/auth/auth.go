@@ -4,19 +4,41 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// passwordParams are the argon2id costs for new hashes.
+var passwordParams = *argon2id.DefaultParams
+
+// SetPasswordParams changes the argon2id memory (in KiB), iterations and
+// parallelism used for new hashes. It's meant to be called once at startup,
+// before any hashing. Existing hashes keep working, and NeedsRehash reports
+// the ones made with lower costs.
+func SetPasswordParams(memory, iterations uint32, parallelism uint8) error {
+	if memory < 8*uint32(parallelism) || iterations < 1 || parallelism < 1 {
+		return errors.New("argon2id needs at least one iteration, one lane and 8 KiB of memory per lane")
+	}
+	passwordParams.Memory = memory
+	passwordParams.Iterations = iterations
+	passwordParams.Parallelism = parallelism
+	return nil
+}
+
+// PasswordParams returns the argon2id memory (in KiB), iterations and
+// parallelism used for new hashes.
+func PasswordParams() (memory, iterations uint32, parallelism uint8) {
+	return passwordParams.Memory, passwordParams.Iterations, passwordParams.Parallelism
+}
+
 func HashPassword(password string) (string, error) {
 
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	params := passwordParams
+	hash, err := argon2id.CreateHash(password, &params)
 
 	return hash, err
 
@@ -29,40 +51,32 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, err
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
-
-	signed, err := token.SignedString([]byte(tokenSecret))
+// NeedsRehash reports whether hash was made with less memory, fewer
+// iterations, fewer lanes or a shorter key than new hashes get now.
+func NeedsRehash(hash string) (bool, error) {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.Parallelism < passwordParams.Parallelism ||
+		params.KeyLength < passwordParams.KeyLength, nil
+}
 
-	return signed, err
+// MakeJWT issues an HS256 token signed with tokenSecret and no kid header.
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return hmacKeySet(tokenSecret).MakeJWT(userID, expiresIn)
 }
 
+// ValidateJWT checks an HS256 token from MakeJWT.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	var claims jwt.RegisteredClaims
-
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
-	}
+	return hmacKeySet(tokenSecret).ValidateJWT(tokenString)
+}
 
-	id, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	return id, nil
+func hmacKeySet(secret string) *KeySet {
+	key := NewHMACKey("", []byte(secret))
+	return &KeySet{signing: key, keys: map[string]*Key{"": key}}
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -91,6 +105,25 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// APITokenPrefix starts every personal access token, so they're easy to
+// tell from JWTs and easy for secret scanners to spot.
+const APITokenPrefix = "chirpy_pat_"
+
+// MakeAPIToken returns a new random personal access token.
+func MakeAPIToken() (string, error) {
+	tok, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return APITokenPrefix + tok, nil
+}
+
+// IsAPIToken reports whether tok looks like a personal access token rather
+// than a JWT.
+func IsAPIToken(tok string) bool {
+	return strings.HasPrefix(tok, APITokenPrefix)
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 
 	// get authorization header
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 	"github.com/jonathangibson/chirpy/internal/auth" // adjust import path
 )
@@ -68,3 +69,80 @@ func TestGetBearerToken_MissingHeader(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+func TestNeedsRehash_AfterRaisingParams(t *testing.T) {
+	t.Cleanup(func() {
+		auth.SetPasswordParams(argon2id.DefaultParams.Memory, argon2id.DefaultParams.Iterations, argon2id.DefaultParams.Parallelism)
+	})
+
+	if err := auth.SetPasswordParams(8*1024, 1, 1); err != nil {
+		t.Fatalf("SetPasswordParams err: %v", err)
+	}
+	old, err := auth.HashPassword("hunter2hunter2")
+	if err != nil {
+		t.Fatalf("HashPassword err: %v", err)
+	}
+	if again, _ := auth.NeedsRehash(old); again {
+		t.Fatal("fresh hash needs rehash")
+	}
+
+	if err := auth.SetPasswordParams(16*1024, 2, 1); err != nil {
+		t.Fatalf("SetPasswordParams err: %v", err)
+	}
+	if again, err := auth.NeedsRehash(old); err != nil || !again {
+		t.Fatalf("NeedsRehash(old) = %v, %v; want true", again, err)
+	}
+	if match, _ := auth.CheckPasswordHash("hunter2hunter2", old); !match {
+		t.Fatal("old hash no longer verifies")
+	}
+
+	upgraded, _ := auth.HashPassword("hunter2hunter2")
+	if again, _ := auth.NeedsRehash(upgraded); again {
+		t.Fatal("upgraded hash needs rehash")
+	}
+
+	// more lanes counts as a raise too
+	if err := auth.SetPasswordParams(16*1024, 2, 2); err != nil {
+		t.Fatalf("SetPasswordParams err: %v", err)
+	}
+	if again, err := auth.NeedsRehash(upgraded); err != nil || !again {
+		t.Fatalf("NeedsRehash after raising parallelism = %v, %v; want true", again, err)
+	}
+	upgraded, _ = auth.HashPassword("hunter2hunter2")
+	if _, _, p := auth.PasswordParams(); p != 2 {
+		t.Fatalf("PasswordParams parallelism = %d, want 2", p)
+	}
+
+	// lowering the costs doesn't downgrade stronger hashes
+	auth.SetPasswordParams(8*1024, 1, 1)
+	if again, _ := auth.NeedsRehash(upgraded); again {
+		t.Fatal("stronger hash flagged after lowering params")
+	}
+}
+
+func TestSetPasswordParams_RejectsNonsense(t *testing.T) {
+	for _, p := range [][3]uint32{{0, 1, 1}, {64 * 1024, 0, 1}, {64 * 1024, 1, 0}} {
+		if err := auth.SetPasswordParams(p[0], p[1], uint8(p[2])); err == nil {
+			t.Errorf("SetPasswordParams%v accepted", p)
+		}
+	}
+}
+
+func TestMakeAPIToken(t *testing.T) {
+	tok, err := auth.MakeAPIToken()
+	if err != nil {
+		t.Fatalf("MakeAPIToken err: %v", err)
+	}
+	if !auth.IsAPIToken(tok) || len(tok) != len(auth.APITokenPrefix)+64 {
+		t.Fatalf("unexpected token %q", tok)
+	}
+	other, _ := auth.MakeAPIToken()
+	if tok == other {
+		t.Fatal("two tokens are the same")
+	}
+
+	jwt, _ := auth.MakeJWT(uuid.New(), secret, time.Minute)
+	if auth.IsAPIToken(jwt) {
+		t.Fatal("JWT taken for an API token")
+	}
+}
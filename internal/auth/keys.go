@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Key is a JWT signing or verification key. Keys parsed from a public key
+// can only verify.
+type Key struct {
+	ID string
+	// NotAfter, if set, is when the key stops verifying tokens, for a key
+	// being phased out on a schedule.
+	NotAfter time.Time
+	method   jwt.SigningMethod
+	sign     any
+	verify   any
+}
+
+// CanSign reports whether k holds a private key.
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// NewHMACKey returns an HS256 key. HMAC keys are secret, so they are never
+// published in the JWKS.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// ParseKeyPEM reads an Ed25519 or RSA key from PEM. A private key (PKCS#8,
+// or PKCS#1 for RSA) gives a key that can sign and verify; a public key
+// (PKIX) gives one that can only verify, for keys being rotated out.
+func ParseKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data", id)
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &Key{ID: id, method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, method: jwt.SigningMethodEdDSA, verify: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return &Key{ID: id, method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return &Key{ID: id, method: jwt.SigningMethodRS256, verify: k}, nil
+	}
+	return nil, fmt.Errorf("key %s: only Ed25519 and RSA keys are supported", id)
+}
+
+// LoadKeyDir reads every *.pem file in dir, using the file name without the
+// extension as the key ID.
+func LoadKeyDir(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKeyPEM(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet signs tokens with one key and accepts tokens signed by any of its
+// keys, so a new signing key can be rolled out while tokens from the old one
+// are still live.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet returns a KeySet that signs with the key whose ID is signingID.
+func NewKeySet(signingID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	ks.signing = ks.keys[signingID]
+	if ks.signing == nil {
+		return nil, fmt.Errorf("no key with id %q", signingID)
+	}
+	if !ks.signing.CanSign() {
+		return nil, fmt.Errorf("key %q is a public key and can't sign", signingID)
+	}
+	return ks, nil
+}
+
+// AccessClaims are the parts of an access token the server acts on.
+type AccessClaims struct {
+	UserID    uuid.UUID
+	TokenID   uuid.UUID // jti; uuid.Nil for tokens issued before jti existed
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Issue signs a new access token for userID, naming the signing key in the
+// kid header and giving the token a fresh jti so it can be revoked on its
+// own.
+func (ks *KeySet) Issue(userID uuid.UUID, expiresIn time.Duration) (string, AccessClaims, error) {
+	now := time.Now().UTC()
+	claims := AccessClaims{
+		UserID:    userID,
+		TokenID:   uuid.New(),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(expiresIn),
+	}
+
+	token := jwt.NewWithClaims(ks.signing.method, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(claims.IssuedAt),
+		ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+		Subject:   userID.String(),
+		ID:        claims.TokenID.String(),
+	})
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+
+	signed, err := token.SignedString(ks.signing.sign)
+	if err != nil {
+		return "", AccessClaims{}, err
+	}
+	return signed, claims, nil
+}
+
+// MakeJWT is Issue for callers that only need the token.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	signed, _, err := ks.Issue(userID, expiresIn)
+	return signed, err
+}
+
+// keyFor finds the key that should have signed t. The token's alg must be
+// the key's own algorithm, so a public key can never be used as an HMAC
+// secret.
+func (ks *KeySet) keyFor(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method != key.method {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	if !key.NotAfter.IsZero() && !time.Now().Before(key.NotAfter) {
+		return nil, fmt.Errorf("key id %q was retired at %s", kid, key.NotAfter.Format(time.RFC3339))
+	}
+	return key.verify, nil
+}
+
+// ParseJWT checks a token against the key named by its kid header and
+// returns its claims. Tokens issued for another purpose, which carry an
+// audience, are rejected. Whether the token has been revoked is up to the
+// caller.
+func (ks *KeySet) ParseJWT(tokenString string) (AccessClaims, error) {
+	var claims jwt.RegisteredClaims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, ks.keyFor)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	if !token.Valid {
+		return AccessClaims{}, fmt.Errorf("invalid token")
+	}
+	if len(claims.Audience) > 0 {
+		return AccessClaims{}, fmt.Errorf("not an access token")
+	}
+
+	out := AccessClaims{}
+	out.UserID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	if claims.ID != "" {
+		out.TokenID, err = uuid.Parse(claims.ID)
+		if err != nil {
+			return AccessClaims{}, fmt.Errorf("invalid jti: %w", err)
+		}
+	}
+	if claims.IssuedAt != nil {
+		out.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		out.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return out, nil
+}
+
+// ValidateJWT is ParseJWT for callers that only need the user.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString)
+	return claims.UserID, err
+}
+
+// emailAudience marks email verification tokens so they can't pass as
+// access tokens, or the other way round.
+const emailAudience = "chirpy-email-verification"
+
+type emailClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// IssueEmailToken signs a token proving that whoever holds it received mail
+// sent to email on behalf of userID.
+func (ks *KeySet) IssueEmailToken(userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(ks.signing.method, emailClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{emailAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Email: email,
+	})
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.sign)
+}
+
+// ParseEmailToken checks a token from IssueEmailToken and returns the user
+// and address it was issued for.
+func (ks *KeySet) ParseEmailToken(tokenString string) (uuid.UUID, string, error) {
+	var claims emailClaims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, ks.keyFor, jwt.WithAudience(emailAudience))
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if !token.Valid || claims.Email == "" {
+		return uuid.Nil, "", fmt.Errorf("invalid token")
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return userID, claims.Email, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key in the set.
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		if jwk, err := ks.keys[id].jwk(); err == nil {
+			out.Keys = append(out.Keys, jwk)
+		}
+	}
+	return out
+}
+
+func (k *Key) jwk() (JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.verify.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64(pub)
+		return jwk, nil
+	case *rsa.PublicKey:
+		jwk.Kty, jwk.N, jwk.E = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+		return jwk, nil
+	}
+	return JWK{}, errors.New("key has no public form")
+}
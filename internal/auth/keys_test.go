@@ -0,0 +1,238 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+)
+
+func ed25519PEM(t *testing.T) []byte {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey err: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey err: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey err: %v", err)
+	}
+	return priv
+}
+
+func mustParse(t *testing.T, id string, data []byte) *auth.Key {
+	t.Helper()
+	k, err := auth.ParseKeyPEM(id, data)
+	if err != nil {
+		t.Fatalf("ParseKeyPEM(%s) err: %v", id, err)
+	}
+	return k
+}
+
+func TestKeySet_SignAndValidate(t *testing.T) {
+	priv := rsaKey(t)
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+
+	for name, data := range map[string][]byte{"ed": ed25519PEM(t), "rsa": rsaPEM} {
+		ks, err := auth.NewKeySet(name, mustParse(t, name, data))
+		if err != nil {
+			t.Fatalf("NewKeySet err: %v", err)
+		}
+		userID := uuid.New()
+		tok, err := ks.MakeJWT(userID, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: MakeJWT err: %v", name, err)
+		}
+		got, err := ks.ValidateJWT(tok)
+		if err != nil {
+			t.Fatalf("%s: ValidateJWT err: %v", name, err)
+		}
+		if got != userID {
+			t.Fatalf("%s: want %s, got %s", name, userID, got)
+		}
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey := mustParse(t, "2024-01", ed25519PEM(t))
+	newKey := mustParse(t, "2024-06", ed25519PEM(t))
+
+	before, _ := auth.NewKeySet("2024-01", oldKey)
+	tok, err := before.MakeJWT(uuid.New(), time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT err: %v", err)
+	}
+
+	// the new signing key still accepts tokens from the old one
+	after, err := auth.NewKeySet("2024-06", oldKey, newKey)
+	if err != nil {
+		t.Fatalf("NewKeySet err: %v", err)
+	}
+	if _, err := after.ValidateJWT(tok); err != nil {
+		t.Fatalf("old token rejected after rotation: %v", err)
+	}
+
+	// until the old key is dropped
+	retired, _ := auth.NewKeySet("2024-06", newKey)
+	if _, err := retired.ValidateJWT(tok); err == nil {
+		t.Fatal("token from a removed key: expected error")
+	}
+}
+
+func TestKeySet_NotAfter(t *testing.T) {
+	legacy := auth.NewHMACKey("", []byte("legacy-secret"))
+	before, _ := auth.NewKeySet("", legacy)
+	tok, err := before.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT err: %v", err)
+	}
+
+	// accepted alongside the new key until its deadline
+	current := mustParse(t, "2024-06", ed25519PEM(t))
+	ks, err := auth.NewKeySet("2024-06", legacy, current)
+	if err != nil {
+		t.Fatalf("NewKeySet err: %v", err)
+	}
+	legacy.NotAfter = time.Now().Add(time.Minute)
+	if _, err := ks.ValidateJWT(tok); err != nil {
+		t.Fatalf("token rejected before the deadline: %v", err)
+	}
+
+	// and refused from then on, even though the token itself is still live
+	legacy.NotAfter = time.Now().Add(-time.Second)
+	if _, err := ks.ValidateJWT(tok); err == nil {
+		t.Fatal("token from a retired key: expected error")
+	}
+}
+
+func TestKeySet_RejectsAlgorithmConfusion(t *testing.T) {
+	priv := rsaKey(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey err: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	signer := mustParse(t, "k1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}))
+	ks, _ := auth.NewKeySet("k1", signer)
+
+	// an HS256 token keyed with the published public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	forged.Header["kid"] = "k1"
+	tok, err := forged.SignedString(pubPEM)
+	if err != nil {
+		t.Fatalf("SignedString err: %v", err)
+	}
+	if _, err := ks.ValidateJWT(tok); err == nil {
+		t.Fatal("HS256 token against an RSA key: expected error")
+	}
+}
+
+func TestNewKeySet_PublicKeyCannotSign(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	k := mustParse(t, "pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if k.CanSign() {
+		t.Fatal("public key reports CanSign")
+	}
+	if _, err := auth.NewKeySet("pub", k); err == nil {
+		t.Fatal("signing with a public key: expected error")
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.pem"), ed25519PEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadKeyDir(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyDir err: %v", err)
+	}
+	keys = append(keys, auth.NewHMACKey("legacy", []byte("secret")))
+
+	ks, err := auth.NewKeySet("a", keys...)
+	if err != nil {
+		t.Fatalf("NewKeySet err: %v", err)
+	}
+	set := ks.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("want only the Ed25519 key published, got %+v", set.Keys)
+	}
+	k := set.Keys[0]
+	if k.Kid != "a" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != "EdDSA" || k.X == "" {
+		t.Fatalf("unexpected JWK %+v", k)
+	}
+}
+
+func TestKeySet_IssueSetsJTI(t *testing.T) {
+	ks, _ := auth.NewKeySet("k", mustParse(t, "k", ed25519PEM(t)))
+	userID := uuid.New()
+
+	tok1, issued, err := ks.Issue(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("Issue err: %v", err)
+	}
+	tok2, _, _ := ks.Issue(userID, time.Minute)
+
+	c1, err := ks.ParseJWT(tok1)
+	if err != nil {
+		t.Fatalf("ParseJWT err: %v", err)
+	}
+	c2, _ := ks.ParseJWT(tok2)
+	if c1.TokenID == uuid.Nil || c1.TokenID != issued.TokenID {
+		t.Fatalf("jti %s, want %s", c1.TokenID, issued.TokenID)
+	}
+	if c1.TokenID == c2.TokenID {
+		t.Fatal("two tokens share a jti")
+	}
+	if c1.UserID != userID {
+		t.Fatalf("want %s, got %s", userID, c1.UserID)
+	}
+}
+
+func TestKeySet_EmailTokensAreNotAccessTokens(t *testing.T) {
+	ks, _ := auth.NewKeySet("k", mustParse(t, "k", ed25519PEM(t)))
+	userID := uuid.New()
+
+	emailTok, err := ks.IssueEmailToken(userID, "a@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueEmailToken err: %v", err)
+	}
+	gotID, gotEmail, err := ks.ParseEmailToken(emailTok)
+	if err != nil {
+		t.Fatalf("ParseEmailToken err: %v", err)
+	}
+	if gotID != userID || gotEmail != "a@example.com" {
+		t.Fatalf("got (%s, %q), want (%s, %q)", gotID, gotEmail, userID, "a@example.com")
+	}
+
+	if _, err := ks.ParseJWT(emailTok); err == nil {
+		t.Fatal("email token accepted as an access token")
+	}
+	accessTok, _ := ks.MakeJWT(userID, time.Hour)
+	if _, _, err := ks.ParseEmailToken(accessTok); err == nil {
+		t.Fatal("access token accepted as an email token")
+	}
+}
@@ -0,0 +1,102 @@
+package auth_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/auth"
+)
+
+// rfcSecret is the SHA-1 seed from RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// the RFC lists 8-digit codes; ours are their last six digits
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range cases {
+		got, err := auth.TOTPCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode err: %v", err)
+		}
+		if got != want {
+			t.Fatalf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret err: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	code, _ := auth.TOTPCode(secret, now)
+	step, ok := auth.ValidateTOTP(secret, code, now)
+	if !ok {
+		t.Fatal("current code rejected")
+	}
+
+	// one step of drift is fine, two is not
+	if got, ok := auth.ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok || got != step {
+		t.Fatalf("code from the previous step: got %d, %v", got, ok)
+	}
+	if _, ok := auth.ValidateTOTP(secret, code, now.Add(90*time.Second)); ok {
+		t.Fatal("stale code accepted")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := auth.ValidateTOTP(secret, bad, now); ok {
+			t.Fatalf("ValidateTOTP(%q) accepted", bad)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := auth.TOTPURI("ABC", "Chirpy", "me@example.com")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("url.Parse err: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+	if got := u.Query().Get("secret"); got != "ABC" {
+		t.Fatalf("secret = %q", got)
+	}
+	if !strings.HasPrefix(u.Path, "/Chirpy:me@example.com") {
+		t.Fatalf("label = %q", u.Path)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes err: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Fatalf("bad code %q", c)
+		}
+		if seen[c] {
+			t.Fatalf("duplicate code %q", c)
+		}
+		seen[c] = true
+
+		typed := " " + strings.ToUpper(strings.ReplaceAll(c, "-", "")) + " "
+		if got := auth.NormalizeRecoveryCode(typed); got != c {
+			t.Fatalf("NormalizeRecoveryCode(%q) = %q, want %q", typed, got, c)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jonathangibson/chirpy/internal/blob"
+)
+
+func TestDisk_PutOpenDelete(t *testing.T) {
+	ctx := context.Background()
+	d, err := blob.NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDisk err: %v", err)
+	}
+
+	if err := d.Put(ctx, "ab/cd.png", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put err: %v", err)
+	}
+	rc, err := d.Open(ctx, "ab/cd.png")
+	if err != nil {
+		t.Fatalf("Open err: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+
+	if err := d.Delete(ctx, "ab/cd.png"); err != nil {
+		t.Fatalf("Delete err: %v", err)
+	}
+	if _, err := d.Open(ctx, "ab/cd.png"); !errors.Is(err, blob.ErrNotFound) {
+		t.Fatalf("Open after delete: want ErrNotFound, got %v", err)
+	}
+	if err := d.Delete(ctx, "ab/cd.png"); err != nil {
+		t.Fatalf("second Delete err: %v", err)
+	}
+}
+
+func TestDisk_RejectsBadKeys(t *testing.T) {
+	ctx := context.Background()
+	d, err := blob.NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDisk err: %v", err)
+	}
+	for _, key := range []string{"", "../x", "a/../../x", "/abs", "a//b", ".hidden", `a\b`} {
+		if err := d.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Fatalf("Put(%q): expected error", key)
+		}
+	}
+}
@@ -8,31 +8,52 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, last_used_at, access_jti, access_expires_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, replaced_by, user_agent, ip_address, last_used_at, access_jti, access_expires_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt sql.NullTime
+	Token           string
+	UserID          uuid.UUID
+	ExpiresAt       sql.NullTime
+	FamilyID        uuid.UUID
+	UserAgent       string
+	IpAddress       string
+	AccessJti       uuid.NullUUID
+	AccessExpiresAt sql.NullTime
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.AccessJti,
+		arg.AccessExpiresAt,
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -41,12 +62,20 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.ReplacedBy,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.AccessJti,
+		&i.AccessExpiresAt,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, replaced_by, user_agent, ip_address, last_used_at, access_jti, access_expires_at
 FROM refresh_tokens
 WHERE token = $1
 `
@@ -61,17 +90,214 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.ReplacedBy,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.AccessJti,
+		&i.AccessExpiresAt,
 	)
 	return i, err
 }
 
-const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
+const listSessions = `-- name: ListSessions :many
+SELECT
+    family_id,
+    (SELECT min(created_at) FROM refresh_tokens AS f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS signed_in_at,
+    last_used_at,
+    user_agent,
+    ip_address,
+    expires_at
+FROM refresh_tokens
+WHERE user_id = $1
+  AND rotated_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+ORDER BY last_used_at DESC
+`
+
+type ListSessionsRow struct {
+	FamilyID   uuid.UUID
+	SignedInAt time.Time
+	LastUsedAt sql.NullTime
+	UserAgent  string
+	IpAddress  string
+	ExpiresAt  sql.NullTime
+}
+
+func (q *Queries) ListSessions(ctx context.Context, userID uuid.UUID) ([]ListSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionsRow
+	for rows.Next() {
+		var i ListSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.SignedInAt,
+			&i.LastUsedAt,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllSessions = `-- name: RevokeAllSessions :many
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at
+`
+
+type RevokeAllSessionsRow struct {
+	AccessJti       uuid.NullUUID
+	AccessExpiresAt sql.NullTime
+}
+
+func (q *Queries) RevokeAllSessions(ctx context.Context, userID uuid.UUID) ([]RevokeAllSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, revokeAllSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RevokeAllSessionsRow
+	for rows.Next() {
+		var i RevokeAllSessionsRow
+		if err := rows.Scan(
+			&i.AccessJti,
+			&i.AccessExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :many
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at
+`
+
+type RevokeRefreshTokenFamilyRow struct {
+	AccessJti       uuid.NullUUID
+	AccessExpiresAt sql.NullTime
+}
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) ([]RevokeRefreshTokenFamilyRow, error) {
+	rows, err := q.db.QueryContext(ctx, revokeRefreshTokenFamily, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RevokeRefreshTokenFamilyRow
+	for rows.Next() {
+		var i RevokeRefreshTokenFamilyRow
+		if err := rows.Scan(
+			&i.AccessJti,
+			&i.AccessExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeSession = `-- name: RevokeSession :many
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at
+`
+
+type RevokeSessionParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+type RevokeSessionRow struct {
+	AccessJti       uuid.NullUUID
+	AccessExpiresAt sql.NullTime
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) ([]RevokeSessionRow, error) {
+	rows, err := q.db.QueryContext(ctx, revokeSession, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RevokeSessionRow
+	for rows.Next() {
+		var i RevokeSessionRow
+		if err := rows.Scan(
+			&i.AccessJti,
+			&i.AccessExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), replaced_by = $2, updated_at = NOW()
 WHERE token = $1
+  AND rotated_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
-	return err
+type RotateRefreshTokenParams struct {
+	Token      string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, arg.Token, arg.ReplacedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
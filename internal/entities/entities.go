@@ -0,0 +1,106 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxHashtagLength is the longest tag, in characters, that Hashtags will return.
+const MaxHashtagLength = 50
+
+// Hashtags returns the distinct #tags in body, lowercased and without the
+// leading #, in the order they first appear. A tag starts at a # that isn't
+// glued to the end of a word, runs over letters, digits and underscores, and
+// must contain at least one letter, so "#1" and "a#b" aren't tags.
+func Hashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '#' || (i > 0 && isWordRune(lastRune(body[:i]))) {
+			continue
+		}
+
+		end := i + 1
+		hasLetter := false
+		for end < len(body) {
+			r, size := utf8.DecodeRuneInString(body[end:])
+			if !isWordRune(r) {
+				break
+			}
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			end += size
+		}
+
+		tag := strings.ToLower(body[i+1 : end])
+		if hasLetter && utf8.RuneCountInString(tag) <= MaxHashtagLength && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		i = end - 1
+	}
+
+	return tags
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// MaxHandleLength is the longest @handle, in characters, that Mentions will
+// return.
+const MaxHandleLength = 20
+
+// Mention is an @handle found in a chirp body. Start and End are byte offsets
+// of the whole token, @ included, so body[Start:End] == "@" + Handle.
+type Mention struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+// Mentions returns every @handle in body in order. A handle starts at an @
+// that isn't glued to the end of a word (so email addresses don't count) and
+// runs over ASCII letters, digits and underscores.
+func Mentions(body string) []Mention {
+	var mentions []Mention
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '@' || (i > 0 && isWordRune(lastRune(body[:i]))) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(body) && isHandleByte(body[end]) {
+			end++
+		}
+
+		// a handle that runs straight into other word characters isn't one
+		if end < len(body) && isWordRune(firstRune(body[end:])) {
+			i = end - 1
+			continue
+		}
+
+		if n := end - i - 1; n > 0 && n <= MaxHandleLength {
+			mentions = append(mentions, Mention{Handle: body[i+1 : end], Start: i, End: end})
+		}
+		i = end - 1
+	}
+
+	return mentions
+}
+
+func isHandleByte(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
@@ -0,0 +1,66 @@
+package entities_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonathangibson/chirpy/internal/entities"
+)
+
+func TestHashtags(t *testing.T) {
+	cases := map[string][]string{
+		"":                              nil,
+		"no tags here":                  nil,
+		"#Go is fun":                    {"go"},
+		"loving #golang and #GoLang":    {"golang"},
+		"#one,#two. (#three)":           {"one", "two", "three"},
+		"email@x.com a#b #1 #2024 #_":   nil,
+		"#snake_case #v2 #café":         {"snake_case", "v2", "café"},
+		"##double":                      {"double"},
+		"#abcdefghijklmnopqrstuvwxyzab": {"abcdefghijklmnopqrstuvwxyzab"},
+	}
+	for in, want := range cases {
+		got := entities.Hashtags(in)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Hashtags(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHashtags_TooLong(t *testing.T) {
+	long := "#" + strings.Repeat("a", entities.MaxHashtagLength+1)
+	if got := entities.Hashtags(long); got != nil {
+		t.Fatalf("expected no tags, got %q", got)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	cases := map[string][]entities.Mention{
+		"":                 nil,
+		"@alice hi":        {{Handle: "alice", Start: 0, End: 6}},
+		"hi @Bob_1, @carl": {{Handle: "Bob_1", Start: 3, End: 9}, {Handle: "carl", Start: 11, End: 16}},
+		"me@example.com":   nil,
+		"@ alone, @@x":     {{Handle: "x", Start: 10, End: 12}},
+		"@josé":            nil,
+		"(@dana)":          {{Handle: "dana", Start: 1, End: 6}},
+	}
+	for in, want := range cases {
+		got := entities.Mentions(in)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Mentions(%q) = %+v, want %+v", in, got, want)
+		}
+		for _, m := range got {
+			if in[m.Start:m.End] != "@"+m.Handle {
+				t.Fatalf("Mentions(%q): offsets %d:%d don't cover @%s", in, m.Start, m.End, m.Handle)
+			}
+		}
+	}
+}
+
+func TestMentions_TooLong(t *testing.T) {
+	long := "@" + strings.Repeat("a", entities.MaxHandleLength+1)
+	if got := entities.Mentions(long); got != nil {
+		t.Fatalf("expected no mentions, got %+v", got)
+	}
+}
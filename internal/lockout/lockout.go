@@ -0,0 +1,207 @@
+// Package lockout tracks failed attempts per key and locks a key out for
+// exponentially longer periods as failures pile up.
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy says how quickly a key gets locked out.
+type Policy struct {
+	// Threshold failures are allowed before the first lockout.
+	Threshold int
+	// BaseDelay is the first lockout; each further failure doubles it, up
+	// to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a key has to go without failures before its count
+	// is forgotten.
+	Window time.Duration
+}
+
+// delay is the lockout earned by the nth consecutive failure.
+func (p Policy) delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.Threshold; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// Status is one key's current state.
+type Status struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Tracker is safe for concurrent use.
+type Tracker struct {
+	policy Policy
+
+	// Now is the clock; tests may replace it.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// entry is a key's state plus the attempts reserved against it that haven't
+// finished yet.
+type entry struct {
+	Status
+	inFlight int
+}
+
+// New returns a Tracker enforcing p.
+func New(p Policy) *Tracker {
+	return &Tracker{policy: p, Now: time.Now, entries: map[string]*entry{}}
+}
+
+// entry returns key's state, dropping it if it has gone stale. The caller
+// holds t.mu.
+func (t *Tracker) entry(key string, now time.Time) *entry {
+	e, ok := t.entries[key]
+	if ok && t.stale(e, now) {
+		delete(t.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (t *Tracker) stale(e *entry, now time.Time) bool {
+	return e.inFlight == 0 && now.After(e.LockedUntil) && now.Sub(e.LastFailure) > t.policy.Window
+}
+
+// Check returns how long key is still locked out for, or 0 if it may try.
+func (t *Tracker) Check(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.Now()
+	e := t.entry(key, now)
+	if e == nil || !now.Before(e.LockedUntil) {
+		return 0
+	}
+	return e.LockedUntil.Sub(now)
+}
+
+// retryBusy is how long a caller is told to wait when attempts already in
+// flight could lock the key; they finish in well under that.
+const retryBusy = time.Second
+
+// Reserve is Check for a caller about to make an attempt. If key may try, the
+// attempt is counted as in flight until Fail or Release ends it, and while
+// in-flight attempts could be enough to lock the key no more are let in. That
+// way concurrent guesses can't all get past the check before any of them is
+// recorded as a failure. It returns how long to wait otherwise, with nothing
+// reserved.
+func (t *Tracker) Reserve(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.Now()
+	e := t.entry(key, now)
+	if e == nil {
+		e = &entry{Status: Status{Key: key}}
+		t.entries[key] = e
+	}
+	if now.Before(e.LockedUntil) {
+		return e.LockedUntil.Sub(now)
+	}
+	if e.inFlight > 0 && t.policy.delay(e.Failures+e.inFlight) > 0 {
+		return retryBusy
+	}
+	e.inFlight++
+	return 0
+}
+
+// Release ends a reserved attempt that didn't fail.
+func (t *Tracker) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.entries[key]; ok && e.inFlight > 0 {
+		e.inFlight--
+	}
+}
+
+// Fail records a failed attempt, ending its reservation if it had one, and
+// returns the lockout it earned, if any.
+func (t *Tracker) Fail(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.Now()
+	e := t.entry(key, now)
+	if e == nil {
+		e = &entry{Status: Status{Key: key}}
+		t.entries[key] = e
+	}
+	if e.inFlight > 0 {
+		e.inFlight--
+	}
+	e.Failures++
+	e.LastFailure = now
+	d := t.policy.delay(e.Failures)
+	if d > 0 {
+		e.LockedUntil = now.Add(d)
+	}
+	return d
+}
+
+// Clear forgets key's failures, as after a successful attempt or an
+// operator's say-so. Attempts still in flight stay reserved. It reports
+// whether there was anything to forget.
+func (t *Tracker) Clear(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return false
+	}
+	if e.inFlight > 0 {
+		had := e.Failures > 0
+		e.Status = Status{Key: key}
+		return had
+	}
+	delete(t.entries, key)
+	return true
+}
+
+// List returns every key with recent failures, most recent first.
+func (t *Tracker) List() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.Now()
+	out := make([]Status, 0, len(t.entries))
+	for key := range t.entries {
+		if e := t.entry(key, now); e != nil && e.Failures > 0 {
+			out = append(out, e.Status)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastFailure.After(out[j].LastFailure) })
+	return out
+}
+
+// Prune drops keys whose failures have aged out, so the tracker doesn't grow
+// without bound.
+func (t *Tracker) Prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.Now()
+	for key, e := range t.entries {
+		if t.stale(e, now) {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package lockout_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/lockout"
+)
+
+func newTracker() (*lockout.Tracker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := lockout.New(lockout.Policy{
+		Threshold: 3,
+		BaseDelay: time.Second,
+		MaxDelay:  10 * time.Second,
+		Window:    time.Minute,
+	})
+	tr.Now = func() time.Time { return now }
+	return tr, &now
+}
+
+func TestTracker_Backoff(t *testing.T) {
+	tr, _ := newTracker()
+
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := tr.Fail("k"); got != w {
+			t.Fatalf("failure %d: lockout %v, want %v", i+1, got, w)
+		}
+	}
+	if got := tr.Check("k"); got != 10*time.Second {
+		t.Fatalf("Check = %v, want 10s", got)
+	}
+	if got := tr.Check("other"); got != 0 {
+		t.Fatalf("Check(other) = %v, want 0", got)
+	}
+}
+
+func TestTracker_LockExpiresAndWindowForgets(t *testing.T) {
+	tr, now := newTracker()
+
+	for i := 0; i < 3; i++ {
+		tr.Fail("k")
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if got := tr.Check("k"); got != 500*time.Millisecond {
+		t.Fatalf("Check = %v, want 500ms", got)
+	}
+
+	*now = now.Add(time.Second)
+	if got := tr.Check("k"); got != 0 {
+		t.Fatalf("Check after lock = %v, want 0", got)
+	}
+	// the count is still remembered inside the window
+	if got := tr.Fail("k"); got != 2*time.Second {
+		t.Fatalf("fourth failure lockout %v, want 2s", got)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if got := tr.Fail("k"); got != 0 {
+		t.Fatalf("failure after window lockout %v, want 0", got)
+	}
+}
+
+func TestTracker_ClearListPrune(t *testing.T) {
+	tr, now := newTracker()
+
+	tr.Fail("a")
+	*now = now.Add(time.Second)
+	tr.Fail("b")
+
+	list := tr.List()
+	if len(list) != 2 || list[0].Key != "b" || list[1].Key != "a" {
+		t.Fatalf("List = %+v, want b then a", list)
+	}
+
+	if !tr.Clear("a") {
+		t.Fatal("Clear(a) = false")
+	}
+	if tr.Clear("a") {
+		t.Fatal("second Clear(a) = true")
+	}
+
+	*now = now.Add(2 * time.Minute)
+	tr.Prune()
+	if list := tr.List(); len(list) != 0 {
+		t.Fatalf("List after prune = %+v", list)
+	}
+}
+
+func TestTracker_ReserveLimitsConcurrentAttempts(t *testing.T) {
+	tr, _ := newTracker()
+
+	// three guesses may be in flight at once, since only the third failure locks
+	for i := 0; i < 3; i++ {
+		if got := tr.Reserve("k"); got != 0 {
+			t.Fatalf("reservation %d: wait %v, want 0", i+1, got)
+		}
+	}
+	if got := tr.Reserve("k"); got == 0 {
+		t.Fatal("fourth concurrent reservation: want a wait")
+	}
+
+	// a guess that wasn't wrong frees its place without counting
+	tr.Release("k")
+	if got := tr.Reserve("k"); got != 0 {
+		t.Fatalf("reservation after release: wait %v, want 0", got)
+	}
+
+	// once they all fail the key is locked as usual
+	for i := 0; i < 3; i++ {
+		tr.Fail("k")
+	}
+	if got := tr.Reserve("k"); got != time.Second {
+		t.Fatalf("Reserve after failures = %v, want 1s", got)
+	}
+}
+
+func TestTracker_ClearKeepsReservations(t *testing.T) {
+	tr, _ := newTracker()
+
+	tr.Fail("k")
+	tr.Reserve("k")
+	tr.Reserve("k")
+	if !tr.Clear("k") {
+		t.Fatal("Clear(k) = false")
+	}
+	if list := tr.List(); len(list) != 0 {
+		t.Fatalf("List after clear = %+v", list)
+	}
+
+	// the two guesses still in flight are still held
+	if got := tr.Reserve("k"); got != 0 {
+		t.Fatalf("third reservation: wait %v, want 0", got)
+	}
+	if got := tr.Reserve("k"); got == 0 {
+		t.Fatal("fourth concurrent reservation: want a wait")
+	}
+}
+
+func TestTracker_ParallelGuessesStopAtThreshold(t *testing.T) {
+	tr, _ := newTracker()
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tr.Reserve("k") == 0 {
+				admitted.Add(1)
+				tr.Fail("k")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the clock never moves, so the lockout never ends
+	if got := admitted.Load(); got != 3 {
+		t.Fatalf("%d guesses admitted, want 3", got)
+	}
+}
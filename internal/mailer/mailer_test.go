@@ -0,0 +1,131 @@
+package mailer_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/mailer"
+)
+
+func TestLog_Send(t *testing.T) {
+	var buf bytes.Buffer
+	m := mailer.NewLog(&buf)
+
+	err := m.Send(context.Background(), mailer.Message{To: "a@example.com", Subject: "Hi", Body: "hello there"})
+	if err != nil {
+		t.Fatalf("Send err: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"To: a@example.com", "Subject: Hi", "hello there"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSend_RejectsHeaderInjection(t *testing.T) {
+	smtp, err := mailer.NewSMTP("127.0.0.1:1", "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTP err: %v", err)
+	}
+	msgs := []mailer.Message{
+		{To: "a@example.com\r\nBcc: b@example.com", Subject: "Hi"},
+		{To: "a@example.com", Subject: "Hi\nBcc: b@example.com"},
+	}
+	for _, m := range []mailer.Mailer{mailer.NewLog(&bytes.Buffer{}), smtp} {
+		for _, msg := range msgs {
+			if err := m.Send(context.Background(), msg); !errors.Is(err, mailer.ErrBadHeader) {
+				t.Errorf("%T.Send(%q) err = %v, want ErrBadHeader", m, msg.To, err)
+			}
+		}
+	}
+}
+
+// fakeSMTP accepts a single message and returns its DATA section.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 fake")
+		var msg strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				data <- msg.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), data
+}
+
+func TestSMTP_Send(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	m, err := mailer.NewSMTP(addr, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTP err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, mailer.Message{To: "a@example.com", Subject: "Reset", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send err: %v", err)
+	}
+
+	got := <-data
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: a@example.com\r\n",
+		"Subject: Reset\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q:\n%s", want, got)
+		}
+	}
+}
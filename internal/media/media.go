@@ -0,0 +1,131 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxPixels caps the decoded size of an image, so a small file can't expand
+// into gigabytes of pixels. 24 megapixels covers phone cameras while keeping
+// a decoded upload to around 100 MB.
+const MaxPixels = 24_000_000
+
+// ErrUnsupportedType is returned for anything that isn't a PNG, JPEG or GIF.
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+var decoders = map[string]func([]byte) (image.Image, error){
+	"image/png":  func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) },
+	"image/jpeg": func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) },
+	"image/gif":  func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) },
+}
+
+var configDecoders = map[string]func([]byte) (image.Config, error){
+	"image/png":  func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) },
+	"image/jpeg": func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) },
+	"image/gif":  func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) },
+}
+
+// Info describes an uploaded image.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect works out what data is from its content, ignoring whatever the
+// client claimed, and reads its dimensions without decoding the pixels.
+func Inspect(data []byte) (Info, error) {
+	ct := http.DetectContentType(data)
+	decode, ok := configDecoders[ct]
+	if !ok {
+		return Info{}, ErrUnsupportedType
+	}
+	cfg, err := decode(data)
+	if err != nil {
+		return Info{}, fmt.Errorf("invalid %s: %w", ct, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return Info{}, fmt.Errorf("image dimensions %dx%d are out of range", cfg.Width, cfg.Height)
+	}
+	return Info{ContentType: ct, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Thumbnail scales the image down so neither side is longer than maxSide,
+// keeping its aspect ratio, and re-encodes it. JPEGs stay JPEGs; everything
+// else becomes a PNG so transparency survives. Call Inspect first.
+func Thumbnail(data []byte, info Info, maxSide int) ([]byte, string, error) {
+	decode, ok := decoders[info.ContentType]
+	if !ok {
+		return nil, "", ErrUnsupportedType
+	}
+	src, err := decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	w, h := fit(src.Bounds().Dx(), src.Bounds().Dy(), maxSide)
+	thumb := scale(src, w, h)
+
+	var buf bytes.Buffer
+	if info.ContentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, thumb)
+	return buf.Bytes(), "image/png", err
+}
+
+// fit returns the size of a w x h image shrunk to fit in a maxSide square.
+func fit(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(1, h*maxSide/w)
+	}
+	return max(1, w*maxSide/h), maxSide
+}
+
+// scale resizes src to w x h by averaging the source pixels that fall under
+// each destination pixel. It reads src in place rather than converting it to
+// RGBA first, so the only new allocation is the thumbnail.
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(out, out.Bounds(), src, b.Min, draw.Src)
+		return out
+	}
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*b.Dy()/h, max((y+1)*b.Dy()/h, y*b.Dy()/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*b.Dx()/w, max((x+1)*b.Dx()/w, x*b.Dx()/w+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, a := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					sum[0] += int(r)
+					sum[1] += int(g)
+					sum[2] += int(bl)
+					sum[3] += int(a)
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			o := out.PixOffset(x, y)
+			for i := range sum {
+				out.Pix[o+i] = uint8(sum[i] / n >> 8)
+			}
+		}
+	}
+	return out
+}
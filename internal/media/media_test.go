@@ -0,0 +1,117 @@
+package media_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/jonathangibson/chirpy/internal/media"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode err: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	info, err := media.Inspect(encodePNG(t, 40, 30))
+	if err != nil {
+		t.Fatalf("Inspect err: %v", err)
+	}
+	if info.ContentType != "image/png" || info.Width != 40 || info.Height != 30 {
+		t.Fatalf("got %+v", info)
+	}
+}
+
+func TestInspect_Rejects(t *testing.T) {
+	if _, err := media.Inspect([]byte("<html><body>hi</body></html>")); !errors.Is(err, media.ErrUnsupportedType) {
+		t.Fatalf("html: want ErrUnsupportedType, got %v", err)
+	}
+
+	// a PNG signature with a garbage body
+	bad := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+	if _, err := media.Inspect(bad); err == nil {
+		t.Fatal("truncated png: expected error")
+	}
+}
+
+func TestInspect_RejectsOversized(t *testing.T) {
+	// rewrite the IHDR of a tiny PNG to claim 5000x5000; only the header is read
+	data := encodePNG(t, 1, 1)
+	binary.BigEndian.PutUint32(data[16:], 5000)
+	binary.BigEndian.PutUint32(data[20:], 5000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if 5000*5000 <= media.MaxPixels {
+		t.Fatal("test image is within MaxPixels")
+	}
+	if _, err := media.Inspect(data); err == nil {
+		t.Fatal("expected error for oversized image")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	cases := []struct {
+		w, h, wantW, wantH int
+	}{
+		{400, 200, 100, 50},
+		{200, 400, 50, 100},
+		{60, 20, 60, 20},
+	}
+	for _, c := range cases {
+		data := encodePNG(t, c.w, c.h)
+		info, err := media.Inspect(data)
+		if err != nil {
+			t.Fatalf("Inspect err: %v", err)
+		}
+		thumb, ct, err := media.Thumbnail(data, info, 100)
+		if err != nil {
+			t.Fatalf("Thumbnail err: %v", err)
+		}
+		if ct != "image/png" {
+			t.Fatalf("content type %q, want image/png", ct)
+		}
+		img, err := png.Decode(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatalf("decoding thumbnail: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != c.wantW || b.Dy() != c.wantH {
+			t.Fatalf("%dx%d: thumbnail is %dx%d, want %dx%d", c.w, c.h, b.Dx(), b.Dy(), c.wantW, c.wantH)
+		}
+		// every source pixel has the same blue, so every average does too
+		if _, _, b, a := img.At(c.wantW-1, c.wantH-1).RGBA(); b>>8 != 200 || a>>8 != 255 {
+			t.Fatalf("%dx%d: corner pixel has blue %d alpha %d, want 200 255", c.w, c.h, b>>8, a>>8)
+		}
+	}
+}
+
+func TestThumbnail_KeepsJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 300)), nil); err != nil {
+		t.Fatalf("jpeg.Encode err: %v", err)
+	}
+	info, err := media.Inspect(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Inspect err: %v", err)
+	}
+	_, ct, err := media.Thumbnail(buf.Bytes(), info, 100)
+	if err != nil || ct != "image/jpeg" {
+		t.Fatalf("got %q, %v", ct, err)
+	}
+}
@@ -0,0 +1,68 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RangeDir looks passwords up in a local copy of a breached-password list
+// kept in the k-anonymity range format used by Have I Been Pwned: one file
+// per five-hex-digit SHA-1 prefix, named after the prefix (optionally with
+// .txt), each line holding the remaining 35 hex digits and a count as
+// "SUFFIX:COUNT". Files are read on demand, so the list can be far larger
+// than memory.
+type RangeDir struct {
+	dir string
+}
+
+// NewRangeDir returns a RangeDir over the range files in dir.
+func NewRangeDir(dir string) (*RangeDir, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("password: " + dir + " is not a directory")
+	}
+	return &RangeDir{dir: dir}, nil
+}
+
+// Count returns how many times pw appears in the list; 0 if it doesn't, or
+// if the list has no file for its prefix.
+func (d *RangeDir) Count(pw string) (int, error) {
+	sum := sha1.Sum([]byte(pw))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(d.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		s, count, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if !ok || !strings.EqualFold(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+	return 0, sc.Err()
+}
@@ -0,0 +1,69 @@
+// Package password decides whether a password is good enough to accept: long
+// enough, hard enough to guess, and not known from a breach.
+package password
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Violation is one reason a password was refused.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Violation codes.
+const (
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeTooWeak  = "too_weak"
+	CodeBreached = "breached"
+)
+
+// Policy is what a password must satisfy.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest acceptable Score, 0 to 4.
+	MinScore int
+}
+
+// DefaultPolicy asks for eight characters and a score of at least 2.
+var DefaultPolicy = Policy{MinLength: 8, MaxLength: 128, MinScore: 2}
+
+// Checker applies a Policy and, if Breaches is set, refuses breached
+// passwords.
+type Checker struct {
+	Policy   Policy
+	Breaches *RangeDir
+}
+
+// Check returns every way pw falls short. userInputs are things like the
+// email and username, which make a password easier to guess if it contains
+// them. The error is only for failing to read the breach list.
+func (c *Checker) Check(pw string, userInputs ...string) ([]Violation, error) {
+	var out []Violation
+
+	n := utf8.RuneCountInString(pw)
+	if n < c.Policy.MinLength {
+		out = append(out, Violation{CodeTooShort, fmt.Sprintf("Password must be at least %d characters", c.Policy.MinLength)})
+	}
+	if c.Policy.MaxLength > 0 && n > c.Policy.MaxLength {
+		out = append(out, Violation{CodeTooLong, fmt.Sprintf("Password must be at most %d characters", c.Policy.MaxLength)})
+	}
+	if score := Score(pw, userInputs...); score < c.Policy.MinScore {
+		out = append(out, Violation{CodeTooWeak, fmt.Sprintf("Password is too easy to guess (strength %d of 4, need %d); try a longer phrase", score, c.Policy.MinScore)})
+	}
+
+	if c.Breaches != nil {
+		count, err := c.Breaches.Count(pw)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			out = append(out, Violation{CodeBreached, "Password has appeared in a data breach; choose a different one"})
+		}
+	}
+	return out, nil
+}
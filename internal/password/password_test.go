@@ -0,0 +1,92 @@
+package password_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonathangibson/chirpy/internal/password"
+)
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		pw      string
+		atMost  int
+		atLeast int
+	}{
+		{"password", 0, 0},
+		{"Summer2024!", 0, 0},
+		{"qwertyuiop", 1, 0},
+		{"aaaaaaaaaaaa", 1, 0},
+		{"abcdefgh12345", 1, 0},
+		{"jonathan1990", 1, 0},
+		{"correct horse battery staple", 4, 4},
+		{"blue-cactus-rides-north", 4, 3},
+		{"g7Kp2xQz", 4, 3},
+	}
+	for _, c := range cases {
+		got := password.Score(c.pw, "jonathan@example.com")
+		if got > c.atMost || got < c.atLeast {
+			t.Errorf("Score(%q) = %d, want %d..%d", c.pw, got, c.atLeast, c.atMost)
+		}
+	}
+}
+
+func codes(vs []password.Violation) map[string]bool {
+	m := map[string]bool{}
+	for _, v := range vs {
+		m[v.Code] = true
+	}
+	return m
+}
+
+func TestChecker_Check(t *testing.T) {
+	c := &password.Checker{Policy: password.DefaultPolicy}
+
+	vs, err := c.Check("abc")
+	if err != nil {
+		t.Fatalf("Check err: %v", err)
+	}
+	got := codes(vs)
+	if !got[password.CodeTooShort] || !got[password.CodeTooWeak] {
+		t.Fatalf("Check(abc) = %+v, want too_short and too_weak", vs)
+	}
+
+	vs, _ = c.Check("correct horse battery staple")
+	if len(vs) != 0 {
+		t.Fatalf("Check(strong) = %+v, want none", vs)
+	}
+}
+
+func TestRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1("correct horse battery staple") = ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42
+	data := "0000000000000000000000000000000000A:3\r\n" +
+		"AD6438836DBE526AA231ABDE2D0EEF74D42:42\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "ABF7A.txt"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := password.NewRangeDir(dir)
+	if err != nil {
+		t.Fatalf("NewRangeDir err: %v", err)
+	}
+	n, err := d.Count("correct horse battery staple")
+	if err != nil || n != 42 {
+		t.Fatalf("Count = %d, %v; want 42", n, err)
+	}
+	// no file for this prefix
+	n, err = d.Count("something else entirely")
+	if err != nil || n != 0 {
+		t.Fatalf("Count(missing) = %d, %v; want 0", n, err)
+	}
+
+	c := &password.Checker{Policy: password.DefaultPolicy, Breaches: d}
+	vs, err := c.Check("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Check err: %v", err)
+	}
+	if !codes(vs)[password.CodeBreached] {
+		t.Fatalf("Check = %+v, want breached", vs)
+	}
+}
@@ -0,0 +1,185 @@
+package password
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// common are passwords, and words in passwords, that attackers try first.
+var common = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234",
+	"111111", "1234567", "dragon", "123123", "baseball", "abc123", "football",
+	"monkey", "letmein", "696969", "shadow", "master", "666666", "qwertyuiop",
+	"123321", "mustang", "1234567890", "michael", "654321", "superman",
+	"1qaz2wsx", "7777777", "121212", "000000", "qazwsx", "123qwe", "killer",
+	"trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter", "buster",
+	"soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel",
+	"starwars", "klaster", "112233", "george", "computer", "michelle",
+	"jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313",
+	"freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger",
+	"princess", "joshua", "cheese", "amanda", "summer", "love", "ashley",
+	"nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321",
+	"dallas", "austin", "thunder", "taylor", "matrix", "welcome", "admin",
+	"login", "passw0rd", "p@ssword", "p@ssw0rd", "secret", "chirpy", "chirp",
+	"changeme", "whatever", "qwerty123", "password1", "football1",
+}
+
+var commonSet = func() map[string]bool {
+	m := make(map[string]bool, len(common))
+	for _, w := range common {
+		m[w] = true
+	}
+	return m
+}()
+
+// keyboard rows, for spotting runs like "qwerty" or "asdf"
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var keyPos = func() map[rune][2]int {
+	m := map[rune][2]int{}
+	for row, keys := range keyboardRows {
+		for col, k := range keys {
+			m[k] = [2]int{row, col}
+		}
+	}
+	return m
+}()
+
+// Score estimates how hard pw is to guess, from 0 (trivial) to 4 (strong),
+// on the same scale as zxcvbn. It is a cruder estimate: known words and the
+// user's own details count as a single guess each, and repeated, sequential
+// or keyboard-adjacent characters add almost nothing.
+func Score(pw string, userInputs ...string) int {
+	lower := strings.ToLower(pw)
+	if lower == "" || commonSet[lower] || commonSet[strings.TrimRight(lower, "0123456789!")] {
+		return 0
+	}
+
+	guesses := bits(pw, lower, userInputs) * math.Log10(2)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// token is a known string and what guessing it costs.
+type token struct {
+	s    []rune
+	bits float64
+}
+
+// bits is the estimated entropy of pw, in bits.
+func bits(pw, lower string, userInputs []string) float64 {
+	runes := []rune(pw)
+	lowerRunes := []rune(lower)
+
+	// known strings are guessed whole
+	var tokens []token
+	for _, in := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(in), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(part)) >= 3 {
+				tokens = append(tokens, token{[]rune(part), 3})
+			}
+		}
+	}
+	for _, w := range common {
+		if len(w) >= 4 {
+			tokens = append(tokens, token{[]rune(w), math.Log2(float64(len(common)))})
+		}
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return len(tokens[i].s) > len(tokens[j].s) })
+
+	cost := make([]float64, len(runes))
+	for i := range cost {
+		cost[i] = -1
+	}
+	for _, t := range tokens {
+		for i := 0; i+len(t.s) <= len(lowerRunes); i++ {
+			if !matchFree(lowerRunes[i:i+len(t.s)], t.s, cost[i:i+len(t.s)]) {
+				continue
+			}
+			cost[i] = t.bits
+			for j := i + 1; j < i+len(t.s); j++ {
+				cost[j] = 0
+			}
+		}
+	}
+
+	// everything else costs a guess from the character set in use, unless
+	// it follows predictably from the character before
+	perChar := math.Log2(float64(charsetSize(runes)))
+	total := 0.0
+	for i, c := range cost {
+		switch {
+		case c >= 0:
+			total += c
+		case i > 0 && predictable(lowerRunes[i-1], lowerRunes[i]):
+			total += 1
+		default:
+			total += perChar
+		}
+	}
+	return total
+}
+
+// matchFree reports whether got equals want and none of it is already part
+// of another token.
+func matchFree(got, want []rune, cost []float64) bool {
+	for i := range want {
+		if got[i] != want[i] || cost[i] >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// predictable reports whether b is a repeat of a, the next or previous
+// character in sequence, or a neighbouring key.
+func predictable(a, b rune) bool {
+	if a == b || a+1 == b || a-1 == b {
+		return true
+	}
+	pa, okA := keyPos[a]
+	pb, okB := keyPos[b]
+	return okA && okB && pa[0] == pb[0] && (pa[1]-pb[1] == 1 || pb[1]-pa[1] == 1)
+}
+
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	for _, c := range []struct {
+		present bool
+		n       int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.present {
+			size += c.n
+		}
+	}
+	return max(size, 2)
+}
@@ -0,0 +1,133 @@
+// Package ratelimit implements token-bucket rate limits over a pluggable
+// store.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period, refilled continuously, with bursts of up
+// to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Policy renders the limit for the RateLimit-Policy header.
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Requests, int(l.Period/time.Second))
+}
+
+func (l Limit) perToken() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result is the outcome of one Take.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed; zero
+	// if this one was.
+	RetryAfter time.Duration
+}
+
+// Store holds buckets by key. Implementations must be safe for concurrent
+// use; a shared backend lets several servers enforce one limit.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// Memory is a Store local to this process.
+type Memory struct {
+	// Now is the clock; tests may replace it.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket refills completely
+}
+
+func NewMemory() *Memory {
+	return &Memory{Now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Take spends a token from key's bucket if there is one.
+func (m *Memory) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	if l.Requests <= 0 || l.Period <= 0 {
+		return Result{}, fmt.Errorf("ratelimit: invalid limit %+v", l)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	capacity := float64(l.Requests)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+
+	// refill for the time since the last request
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+elapsed.Seconds()/l.perToken().Seconds())
+		b.last = now
+	}
+
+	res := Result{Limit: l}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(l.perToken()))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((capacity - b.tokens) * float64(l.perToken()))
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// Prune drops buckets that have refilled, which are no different from
+// missing ones.
+func (m *Memory) Prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// seconds rounds up, so clients never come back early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
+
+// WriteHeaders sets the RateLimit-* headers for res, and Retry-After if the
+// request was refused.
+func WriteHeaders(w http.ResponseWriter, res Result) {
+	h := w.Header()
+	h.Set("RateLimit-Policy", res.Limit.Policy())
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", seconds(res.Reset))
+	if !res.Allowed {
+		h.Set("Retry-After", seconds(res.RetryAfter))
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/ratelimit"
+)
+
+func newMemory() (*ratelimit.Memory, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := ratelimit.NewMemory()
+	m.Now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestMemory_BurstThenRefill(t *testing.T) {
+	m, now := newMemory()
+	ctx := context.Background()
+	lim := ratelimit.Limit{Requests: 3, Period: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		res, err := m.Take(ctx, "k", lim)
+		if err != nil || !res.Allowed {
+			t.Fatalf("request %d: allowed=%v err=%v", i+1, res.Allowed, err)
+		}
+		if res.Remaining != 2-i {
+			t.Fatalf("request %d: remaining %d, want %d", i+1, res.Remaining, 2-i)
+		}
+	}
+
+	res, _ := m.Take(ctx, "k", lim)
+	if res.Allowed {
+		t.Fatal("fourth request allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("RetryAfter %v, want 1s", res.RetryAfter)
+	}
+
+	// other keys have their own bucket
+	if res, _ := m.Take(ctx, "other", lim); !res.Allowed {
+		t.Fatal("other key refused")
+	}
+
+	*now = now.Add(time.Second)
+	if res, _ := m.Take(ctx, "k", lim); !res.Allowed {
+		t.Fatal("refused after refill")
+	}
+	if res, _ := m.Take(ctx, "k", lim); res.Allowed {
+		t.Fatal("allowed a second request after one token refilled")
+	}
+}
+
+func TestMemory_Prune(t *testing.T) {
+	m, now := newMemory()
+	ctx := context.Background()
+	lim := ratelimit.Limit{Requests: 2, Period: 2 * time.Second}
+
+	m.Take(ctx, "k", lim)
+	m.Take(ctx, "k", lim)
+	*now = now.Add(2 * time.Second)
+	m.Prune()
+
+	// a pruned bucket starts full again
+	res, _ := m.Take(ctx, "k", lim)
+	if !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("after prune: allowed=%v remaining=%d", res.Allowed, res.Remaining)
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	ratelimit.WriteHeaders(w, ratelimit.Result{
+		Limit:      ratelimit.Limit{Requests: 60, Period: time.Minute},
+		Remaining:  0,
+		Reset:      1500 * time.Millisecond,
+		RetryAfter: 200 * time.Millisecond,
+	})
+
+	want := map[string]string{
+		"RateLimit-Policy":    "60;w=60",
+		"RateLimit-Limit":     "60",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+		"Retry-After":         "1",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
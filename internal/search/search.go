@@ -0,0 +1,72 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ParseQuery turns a user search string into Postgres to_tsquery syntax.
+// Bare words must all match, "quoted text" matches as a phrase and a
+// trailing * matches by prefix (e.g. chir*). Everything other than letters
+// and digits is dropped, so the result is always a valid tsquery.
+func ParseQuery(q string) (string, error) {
+	var terms []string
+
+	for i, part := range strings.Split(q, `"`) {
+		// odd parts sit between a pair of quotes
+		if i%2 == 1 {
+			if t := phrase(strings.Fields(part)); t != "" {
+				terms = append(terms, t)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			lexemes := lexemes(word)
+			if len(lexemes) == 0 {
+				continue
+			}
+			if prefix {
+				lexemes[len(lexemes)-1] += ":*"
+			}
+			if len(lexemes) == 1 {
+				terms = append(terms, lexemes[0])
+			} else {
+				terms = append(terms, "("+strings.Join(lexemes, " <-> ")+")")
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("search query is empty")
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+func phrase(words []string) string {
+	var all []string
+	for _, w := range words {
+		all = append(all, lexemes(w)...)
+	}
+	switch len(all) {
+	case 0:
+		return ""
+	case 1:
+		return all[0]
+	}
+	return "(" + strings.Join(all, " <-> ") + ")"
+}
+
+// lexemes splits a word on anything that isn't a letter or digit and quotes
+// each piece.
+func lexemes(word string) []string {
+	var out []string
+	for _, f := range strings.FieldsFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		out = append(out, "'"+strings.ToLower(f)+"'")
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/jonathangibson/chirpy/internal/search"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := map[string]string{
+		"hello":                   "'hello'",
+		"hello world":             "'hello' & 'world'",
+		`"hello world"`:           "('hello' <-> 'world')",
+		"chir*":                   "'chir':*",
+		`go "big data" chir*`:     "'go' & ('big' <-> 'data') & 'chir':*",
+		"don't":                   "('don' <-> 't')",
+		"it's & ok | ! (drop) ':": "('it' <-> 's') & 'ok' & 'drop'",
+		`unterminated "phrase`:    "'unterminated' & 'phrase'",
+	}
+	for in, want := range cases {
+		got, err := search.ParseQuery(in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) err: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("ParseQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseQuery_Empty(t *testing.T) {
+	for _, in := range []string{"", "   ", `""`, "*** &&"} {
+		if _, err := search.ParseQuery(in); err == nil {
+			t.Fatalf("ParseQuery(%q): expected error", in)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// only live chirps can be liked; liking a rechirp likes the original
+	chirp, err := cfg.originalChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// liking twice is a no-op
+	err = cfg.Queries.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// likes sent to a rechirp landed on the original, so unlike it there
+	chirp, err := cfg.originalChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// unliking something you haven't liked is a no-op
+	err = cfg.Queries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/lockout"
+)
+
+// An account gets a few guesses before it's slowed down. An address gets
+// more, since many users can sit behind one NAT.
+var (
+	accountLockoutPolicy = lockout.Policy{
+		Threshold: 5,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+	ipLockoutPolicy = lockout.Policy{
+		Threshold: 20,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+	// Second factor codes are counted per account across challenges, so
+	// logging in again doesn't buy a fresh set of guesses.
+	codeLockoutPolicy = lockout.Policy{
+		Threshold: maxChallengeAttempts,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+)
+
+const lockoutPruneInterval = 10 * time.Minute
+
+// loginLockouts tracks failed logins per account and per client address, and
+// wrong second factor codes per account. Keys carry an "account:", "ip:" or
+// "2fa:" prefix so the admin endpoints can name any of them.
+type loginLockouts struct {
+	accounts *lockout.Tracker
+	ips      *lockout.Tracker
+	codes    *lockout.Tracker
+}
+
+func newLoginLockouts() *loginLockouts {
+	return &loginLockouts{
+		accounts: lockout.New(accountLockoutPolicy),
+		ips:      lockout.New(ipLockoutPolicy),
+		codes:    lockout.New(codeLockoutPolicy),
+	}
+}
+
+func accountLockoutKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+func codeLockoutKey(userID uuid.UUID) string {
+	return "2fa:" + userID.String()
+}
+
+// reserve returns how long the caller must wait before trying again. If it
+// returns 0 the attempt is held against both the account and the address
+// until fail or succeed settles it, so parallel guesses can't all get past
+// the check before the first is recorded.
+func (l *loginLockouts) reserve(email, ip string) time.Duration {
+	account := accountLockoutKey(email)
+	if wait := l.accounts.Reserve(account); wait > 0 {
+		return wait
+	}
+	if wait := l.ips.Reserve(ipLockoutKey(ip)); wait > 0 {
+		l.accounts.Release(account)
+		return wait
+	}
+	return 0
+}
+
+// fail records a wrong password and returns the lockout it earned, if any.
+func (l *loginLockouts) fail(email, ip string) time.Duration {
+	return max(l.accounts.Fail(accountLockoutKey(email)), l.ips.Fail(ipLockoutKey(ip)))
+}
+
+// succeed resets the account. The address keeps its count, or one account
+// the attacker controls could be used to wipe it between guesses.
+func (l *loginLockouts) succeed(email, ip string) {
+	account := accountLockoutKey(email)
+	l.accounts.Release(account)
+	l.accounts.Clear(account)
+	l.ips.Release(ipLockoutKey(ip))
+}
+
+// checkCode returns how long the account must wait before it is given another
+// second factor challenge.
+func (l *loginLockouts) checkCode(userID uuid.UUID) time.Duration {
+	return l.codes.Check(codeLockoutKey(userID))
+}
+
+// reserveCode is reserve for a second factor code. A reserved attempt ends
+// with failCode, succeedCode or, if it never got checked, releaseCode.
+func (l *loginLockouts) reserveCode(userID uuid.UUID) time.Duration {
+	return l.codes.Reserve(codeLockoutKey(userID))
+}
+
+func (l *loginLockouts) failCode(userID uuid.UUID) time.Duration {
+	return l.codes.Fail(codeLockoutKey(userID))
+}
+
+func (l *loginLockouts) releaseCode(userID uuid.UUID) {
+	l.codes.Release(codeLockoutKey(userID))
+}
+
+func (l *loginLockouts) succeedCode(userID uuid.UUID) {
+	key := codeLockoutKey(userID)
+	l.codes.Release(key)
+	l.codes.Clear(key)
+}
+
+func (l *loginLockouts) list() []lockout.Status {
+	out := append(l.accounts.List(), l.ips.List()...)
+	return append(out, l.codes.List()...)
+}
+
+func (l *loginLockouts) clear(key string) bool {
+	switch {
+	case strings.HasPrefix(key, "ip:"):
+		return l.ips.Clear(key)
+	case strings.HasPrefix(key, "2fa:"):
+		return l.codes.Clear(key)
+	}
+	return l.accounts.Clear(key)
+}
+
+func (l *loginLockouts) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.accounts.Prune()
+			l.ips.Prune()
+			l.codes.Prune()
+		}
+	}
+}
+
+// dummyPasswordHash is checked against when the email is unknown, so a
+// login for a missing account takes as long as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("chirpy-dummy-password")
+	if err != nil {
+		log.Fatalf("Error hashing dummy password: %s", err)
+	}
+	return hash
+})
+
+// respondLockedOut writes a 429 telling the client when to come back.
+func respondLockedOut(w http.ResponseWriter, wait time.Duration) {
+	secs := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	respondWithJSON(w, 429, errorResponse{Error: "Too many failed login attempts, try again later"})
+}
+
+func (cfg *apiConfig) listLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// admins only
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	respondWithJSON(w, 200, cfg.Lockouts.list())
+
+}
+
+func (cfg *apiConfig) clearLockoutHandler(w http.ResponseWriter, r *http.Request) {
+
+	// admins only
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	key := r.PathValue("key")
+	if !cfg.Lockouts.clear(key) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	logSecurityEvent(r, "lockout_cleared", uuid.Nil, "key=%s", key)
+
+	w.WriteHeader(204)
+
+}
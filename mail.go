@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/mailer"
+)
+
+const mailSendTimeout = 30 * time.Second
+
+// loadMailer picks the mailer from MAILER. "smtp" relays through SMTP_ADDR;
+// "log" writes mail to MAIL_LOG_FILE, or the log if that's unset. Mail
+// carries reset tokens and verification links, so only the dev platform
+// falls back to the log when MAILER is unset.
+func loadMailer(platform string) (mailer.Mailer, error) {
+	kind := os.Getenv("MAILER")
+	if kind == "" && platform == "dev" {
+		kind = "log"
+	}
+	switch kind {
+	case "smtp":
+		from := os.Getenv("MAIL_FROM")
+		if from == "" {
+			return nil, fmt.Errorf("MAIL_FROM is empty")
+		}
+		return mailer.NewSMTP(os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "log":
+	case "":
+		return nil, fmt.Errorf("MAILER is empty; set it to smtp, or to log to write mail to the log")
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+	path := os.Getenv("MAIL_LOG_FILE")
+	if path == "" {
+		return mailer.NewLog(log.Writer()), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return mailer.NewLog(f), nil
+}
+
+// sendMail delivers m in the background so the response doesn't wait on the
+// mail server, or reveal by its timing whether anything was sent.
+func (cfg *apiConfig) sendMail(m mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := cfg.Mailer.Send(ctx, m); err != nil {
+			log.Printf("Error sending mail: %s", err)
+		}
+	}()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"      // logging errors and info
@@ -11,7 +12,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/jonathangibson/chirpy/internal/blob"
 	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/ratelimit"
 	_ "github.com/lib/pq"
 )
 
@@ -20,21 +23,49 @@ type errorResponse struct {
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsUpgraded   bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  *string   `json:"pending_email,omitempty"`
+	Username      *string   `json:"username"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsUpgraded    bool      `json:"is_chirpy_red"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	ID           uuid.UUID    `json:"id"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Body         string       `json:"body"`
+	UserId       uuid.UUID    `json:"user_id"`
+	InReplyTo    *uuid.UUID   `json:"in_reply_to"`
+	Deleted      bool         `json:"deleted,omitempty"`
+	LikeCount    int64        `json:"like_count"`
+	LikedByMe    *bool        `json:"liked_by_me,omitempty"`
+	RechirpOf    *Chirp       `json:"rechirp_of,omitempty"`
+	QuoteOf      *Chirp       `json:"quote_of,omitempty"`
+	RechirpCount int64        `json:"rechirp_count"`
+	Edited       bool         `json:"edited"`
+	Mentions     []Mention    `json:"mentions"`
+	Media        []Attachment `json:"media"`
+}
+
+// Mention is an @handle in a chirp body that resolved to a user. Start and
+// End are byte offsets into the body.
+type Mention struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Start    int       `json:"start"`
+	End      int       `json:"end"`
+}
+
+type chirpPage struct {
+	Chirps []Chirp `json:"chirps"`
+	Next   *string `json:"next"`
+	Prev   *string `json:"prev"`
 }
 
 var naughty = map[string]struct{}{
@@ -70,24 +101,98 @@ func stripProfane(s string) string {
 	return strings.Join(words, " ")
 }
 
+// chirpFromDB converts a chirp row for a response. Deleted chirps that were
+// kept as tombstones come back with no body.
+func chirpFromDB(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserId:    c.UserID,
+		Mentions:  []Mention{},
+		Media:     []Attachment{},
+	}
+	if c.InReplyTo.Valid {
+		chirp.InReplyTo = &c.InReplyTo.UUID
+	}
+	if c.EditedAt.Valid {
+		chirp.Edited = true
+	}
+	if c.DeletedAt.Valid {
+		chirp.Body = ""
+		chirp.Deleted = true
+	}
+	return chirp
+}
+
+func chirpsFromDB(chirps []database.Chirp) []Chirp {
+	out := make([]Chirp, 0, len(chirps))
+	for _, c := range chirps {
+		out = append(out, chirpFromDB(c))
+	}
+	return out
+}
+
 func routes(cfg *apiConfig) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /api/healthz", healthzHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
 	mux.HandleFunc("GET /admin/metrics", cfg.writeNumberOfRequests)
 	mux.HandleFunc("POST /api/users", cfg.addUserHandler)
 	mux.HandleFunc("POST /admin/reset", cfg.resetHandler)
+	mux.HandleFunc("POST /admin/users/{userID}/ban", cfg.banUserHandler)
+	mux.HandleFunc("DELETE /admin/users/{userID}/ban", cfg.unbanUserHandler)
+	mux.HandleFunc("GET /admin/lockouts", cfg.listLockoutsHandler)
+	mux.HandleFunc("DELETE /admin/lockouts/{key}", cfg.clearLockoutHandler)
 	mux.HandleFunc("POST /api/chirps", cfg.chirpsHandler)
 	mux.HandleFunc("GET /api/chirps", cfg.getChirpsHandler)
+	mux.HandleFunc("GET /api/chirps/search", cfg.searchChirpsHandler)
 	mux.HandleFunc("POST /api/login", cfg.loginHandler)
+	mux.HandleFunc("POST /api/login/2fa", cfg.loginTwoFactorHandler)
+	mux.HandleFunc("POST /api/2fa/totp/enroll", cfg.enrollTOTPHandler)
+	mux.HandleFunc("POST /api/2fa/totp/confirm", cfg.confirmTOTPHandler)
+	mux.HandleFunc("POST /api/2fa/totp/disable", cfg.disableTOTPHandler)
+	mux.HandleFunc("POST /api/password-reset/request", cfg.requestPasswordResetHandler)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.confirmPasswordResetHandler)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getOneChirpHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", cfg.repliesHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.threadHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.likeChirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.unlikeChirpHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.rechirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.unrechirpHandler)
 	mux.HandleFunc("POST /api/refresh", cfg.refreshHandler)
 	mux.HandleFunc("POST /api/revoke", cfg.revokeHandler)
+	mux.HandleFunc("POST /api/tokens", cfg.createAPITokenHandler)
+	mux.HandleFunc("GET /api/tokens", cfg.listAPITokensHandler)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", cfg.deleteAPITokenHandler)
+	mux.HandleFunc("GET /api/sessions", cfg.listSessionsHandler)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.revokeSessionHandler)
+	mux.HandleFunc("POST /api/sessions/revoke-all", cfg.revokeAllSessionsHandler)
 	mux.HandleFunc("PUT /api/users", cfg.updateUserHandler)
+	mux.HandleFunc("GET /api/users/verify-email", cfg.verifyEmailHandler)
+	mux.HandleFunc("POST /api/users/verify-email/resend", cfg.resendVerificationHandler)
+	mux.HandleFunc("GET /api/users/by-username/{username}", cfg.getUserByUsernameHandler)
+	mux.HandleFunc("GET /api/users/{userID}", cfg.getProfileHandler)
+	mux.HandleFunc("PATCH /api/users/me", cfg.updateProfileHandler)
+	mux.HandleFunc("POST /api/media", cfg.uploadMediaHandler)
+	mux.HandleFunc("GET /api/media/{mediaID}", cfg.getMediaHandler)
+	mux.HandleFunc("GET /api/media/{mediaID}/thumbnail", cfg.getMediaThumbnailHandler)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirpHandler)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.editChirpHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/history", cfg.chirpHistoryHandler)
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.upgradeHandler)
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.followHandler)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.unfollowHandler)
+	mux.HandleFunc("GET /api/followers/{userID}", cfg.followersHandler)
+	mux.HandleFunc("GET /api/following/{userID}", cfg.followingHandler)
+	mux.HandleFunc("GET /api/timeline", cfg.timelineHandler)
+	mux.HandleFunc("GET /api/tags/{tag}/chirps", cfg.tagChirpsHandler)
+	mux.HandleFunc("GET /api/mentions", cfg.mentionsHandler)
 	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("."))))) // register file server for /app/
 	mux.Handle("/app", cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))  // and for just /app because why not
-	return mux                                                                                              // return the router
+	return cfg.middlewareRateLimit(mux)                                                                     // return the router, rate limited
 }
 
 func main() {
@@ -103,9 +208,9 @@ func main() {
 		platform = "prod"
 	}
 
-	secret := os.Getenv("SECRET")
-	if secret == "" {
-		log.Fatal("SECRET is empty")
+	keys, err := loadKeySet(os.Getenv("SECRET"), os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_SIGNING_KEY_ID"), os.Getenv("LEGACY_SECRET_UNTIL"))
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	apiKey := os.Getenv("POLKA_KEY")
@@ -113,6 +218,33 @@ func main() {
 		log.Fatal("POLKA_KEY is empty")
 	}
 
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	blobs, err := blob.NewDisk(mediaDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := loadPasswordHashing(); err != nil {
+		log.Fatal(err)
+	}
+	passwords, err := loadPasswordChecker()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mail, err := loadMailer(platform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	baseURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal(err)
@@ -121,12 +253,40 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	denylist := newDenylist(dbQueries)
+	if err := denylist.sync(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	go denylist.run(context.Background(), denylistSyncInterval)
+
 	cfg := apiConfig{
-		Queries:  dbQueries,
-		Platform: platform,
-		Secret:   secret,
-		ApiKey:   apiKey,
+		Queries:   dbQueries,
+		DB:        db,
+		Denylist:  denylist,
+		Platform:  platform,
+		Keys:      keys,
+		ApiKey:    apiKey,
+		AdminKey:  os.Getenv("ADMIN_KEY"),
+		Blobs:     blobs,
+		Mailer:    mail,
+		Lockouts:  newLoginLockouts(),
+		Passwords: passwords,
+		RedCache:  &chirpyRedCache{entries: map[uuid.UUID]chirpyRedEntry{}},
+		BaseURL:   baseURL,
+
+		RequireVerifiedEmail: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+	}
+
+	go cfg.runMediaCollector(context.Background(), mediaCollectInterval)
+	go cfg.Lockouts.run(context.Background(), lockoutPruneInterval)
+
+	// RATE_LIMIT=off is for load tests and local scripts
+	if os.Getenv("RATE_LIMIT") != "off" {
+		limits := ratelimit.NewMemory()
+		cfg.RateLimits = limits
+		go runRateLimitPruner(context.Background(), limits, cfg.RedCache, rateLimitPruneInterval)
 	}
+	dummyPasswordHash()
 
 	log.Println("Now starting server...!")
 	log.Fatal(http.ListenAndServe(":8080", routes(&cfg)))
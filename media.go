@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/blob"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/media"
+)
+
+const (
+	maxUploadSize     = 5 << 20
+	thumbnailMaxSide  = 320
+	multipartOverhead = 64 << 10
+
+	maxChirpMedia    = 4
+	maxAltTextLength = 1000
+
+	// media released by a deleted chirp or replaced avatar is kept a little
+	// while in case a client still has the URL; uploads that were never used
+	// for anything are kept for a day
+	releasedMediaGrace   = time.Hour
+	unusedMediaTTL       = 24 * time.Hour
+	mediaCollectInterval = 10 * time.Minute
+)
+
+type Media struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+// Attachment is media as it appears on a chirp.
+type Attachment struct {
+	Media
+	AltText string `json:"alt_text"`
+}
+
+func mediaURL(id uuid.UUID) string {
+	return "/api/media/" + id.String()
+}
+
+func mediaFromDB(m database.MediaFile) Media {
+	return Media{
+		ID:           m.ID,
+		CreatedAt:    m.CreatedAt,
+		ContentType:  m.ContentType,
+		SizeBytes:    m.SizeBytes,
+		Width:        m.Width,
+		Height:       m.Height,
+		URL:          mediaURL(m.ID),
+		ThumbnailURL: mediaURL(m.ID) + "/thumbnail",
+	}
+}
+
+// errNotOwnMedia means a request named media that doesn't exist or belongs
+// to someone else.
+var errNotOwnMedia = errors.New("no such media")
+
+// ownMedia checks that userID uploaded media id.
+func (cfg *apiConfig) ownMedia(ctx context.Context, userID, id uuid.UUID) error {
+	file, err := cfg.Queries.GetMediaFile(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && file.UserID != userID) {
+		return errNotOwnMedia
+	}
+	return err
+}
+
+// mediaRef is an attachment as given in a request.
+type mediaRef struct {
+	ID      string `json:"id"`
+	AltText string `json:"alt_text"`
+}
+
+// parseMediaRefs validates the attachments for a new chirp and returns them
+// ready for AttachChirpMedia, minus the chirp id. It doesn't check who owns
+// them.
+func parseMediaRefs(refs []mediaRef) (database.AttachChirpMediaParams, error) {
+	var params database.AttachChirpMediaParams
+	if len(refs) > maxChirpMedia {
+		return params, fmt.Errorf("a chirp can have at most %d attachments", maxChirpMedia)
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for i, ref := range refs {
+		id, err := uuid.Parse(ref.ID)
+		if err != nil {
+			return params, errors.New("unable to parse media id")
+		}
+		if seen[id] {
+			return params, errors.New("the same media is attached twice")
+		}
+		seen[id] = true
+
+		alt := strings.TrimSpace(ref.AltText)
+		if utf8.RuneCountInString(alt) > maxAltTextLength {
+			return params, fmt.Errorf("alt text must be at most %d characters", maxAltTextLength)
+		}
+
+		params.MediaIds = append(params.MediaIds, id)
+		params.Positions = append(params.Positions, int32(i))
+		params.AltTexts = append(params.AltTexts, alt)
+	}
+	return params, nil
+}
+
+// releaseMedia marks media that have just lost a reference, so the collector
+// can remove any that nothing else uses.
+func releaseMedia(ctx context.Context, q *database.Queries, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return q.ReleaseMedia(ctx, ids)
+}
+
+// collectMedia deletes unused media and their blobs, returning how many went.
+func (cfg *apiConfig) collectMedia(ctx context.Context) (int, error) {
+	now := time.Now()
+	gone, err := cfg.Queries.DeleteCollectableMedia(ctx, database.DeleteCollectableMediaParams{
+		ReleasedBefore: sql.NullTime{Time: now.Add(-releasedMediaGrace), Valid: true},
+		UploadedBefore: now.Add(-unusedMediaTTL),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// the rows are already gone, so a blob we fail to delete is just litter
+	for _, m := range gone {
+		for _, key := range []string{m.StorageKey, m.ThumbnailKey} {
+			if err := cfg.Blobs.Delete(ctx, key); err != nil {
+				log.Printf("Error deleting blob %s: %s", key, err)
+			}
+		}
+	}
+	return len(gone), nil
+}
+
+// runMediaCollector calls collectMedia every interval until ctx is done.
+func (cfg *apiConfig) runMediaCollector(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := cfg.collectMedia(ctx)
+			if err != nil {
+				log.Printf("Error collecting media: %s", err)
+			} else if n > 0 {
+				log.Printf("Collected %d unused media files", n)
+			}
+		}
+	}
+}
+
+// readUpload returns the contents of the "file" part of a multipart upload.
+// It reads at most one byte more than maxUploadSize so callers can tell an
+// oversized file from one that is exactly at the limit.
+func readUpload(r *http.Request) ([]byte, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("missing file part")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+		return io.ReadAll(io.LimitReader(part, maxUploadSize+1))
+	}
+}
+
+// storeMedia writes the original and its thumbnail to the blob store and
+// records them. Blobs are cleaned up if anything fails part way.
+func (cfg *apiConfig) storeMedia(ctx context.Context, userID uuid.UUID, data []byte, info media.Info, thumb []byte, thumbType string) (database.MediaFile, error) {
+	id := uuid.New()
+	key := "originals/" + id.String()
+	thumbKey := "thumbnails/" + id.String()
+
+	err := cfg.Blobs.Put(ctx, key, bytes.NewReader(data))
+	if err != nil {
+		return database.MediaFile{}, err
+	}
+	err = cfg.Blobs.Put(ctx, thumbKey, bytes.NewReader(thumb))
+	if err != nil {
+		cfg.Blobs.Delete(ctx, key)
+		return database.MediaFile{}, err
+	}
+
+	file, err := cfg.Queries.CreateMediaFile(ctx, database.CreateMediaFileParams{
+		ID:                   id,
+		UserID:               userID,
+		ContentType:          info.ContentType,
+		SizeBytes:            int64(len(data)),
+		Width:                int32(info.Width),
+		Height:               int32(info.Height),
+		StorageKey:           key,
+		ThumbnailKey:         thumbKey,
+		ThumbnailContentType: thumbType,
+	})
+	if err != nil {
+		cfg.Blobs.Delete(ctx, key)
+		cfg.Blobs.Delete(ctx, thumbKey)
+		return database.MediaFile{}, err
+	}
+	return file, nil
+}
+
+func (cfg *apiConfig) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// read the file, refusing to buffer more than the limit
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+multipartOverhead)
+	data, err := readUpload(r)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) || len(data) > maxUploadSize {
+		respondWithJSON(w, 413, errorResponse{Error: "File is too large"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading upload: %s", err)
+		respondWithJSON(w, 400, errorResponse{Error: "Expected a multipart form with a file field"})
+		return
+	}
+
+	// trust the bytes, not the client's content type
+	info, err := media.Inspect(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithJSON(w, 415, errorResponse{Error: "Only PNG, JPEG and GIF images are supported"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// make the thumbnail
+	thumb, thumbType, err := media.Thumbnail(data, info, thumbnailMaxSide)
+	if err != nil {
+		log.Printf("Error making thumbnail: %s", err)
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to decode image"})
+		return
+	}
+
+	// store everything
+	file, err := cfg.storeMedia(r.Context(), userID, data, info, thumb, thumbType)
+	if err != nil {
+		log.Printf("Error storing media: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 201, mediaFromDB(file))
+
+}
+
+// serveMedia streams a stored blob. Media never changes once uploaded, so
+// it can be cached forever.
+func (cfg *apiConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+
+	// parse media id
+	id, err := uuid.Parse(r.PathValue("mediaID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse media id"})
+		return
+	}
+
+	// look it up
+	file, err := cfg.Queries.GetMediaFile(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting media: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	key, contentType := file.StorageKey, file.ContentType
+	if thumbnail {
+		key, contentType = file.ThumbnailKey, file.ThumbnailContentType
+	}
+
+	// open the blob
+	rc, err := cfg.Blobs.Open(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening media: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(200)
+	io.Copy(w, rc)
+
+}
+
+func (cfg *apiConfig) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, false)
+}
+
+func (cfg *apiConfig) getMediaThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, true)
+}
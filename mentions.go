@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/entities"
+)
+
+// mentionChirp records the @handles in a live chirp that belong to a user.
+// Handles that don't match anyone stay plain text.
+func mentionChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	mentions := entities.Mentions(chirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	// usernames are unique regardless of case
+	handles := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		handles = append(handles, strings.ToLower(m.Handle))
+	}
+	users, err := q.GetUsersByUsernames(ctx, handles)
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]uuid.UUID, len(users))
+	for _, u := range users {
+		ids[strings.ToLower(u.Username.String)] = u.ID
+	}
+
+	params := database.CreateChirpMentionsParams{ChirpID: chirp.ID}
+	for _, m := range mentions {
+		id, ok := ids[strings.ToLower(m.Handle)]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, id)
+		params.StartOffsets = append(params.StartOffsets, int32(m.Start))
+		params.EndOffsets = append(params.EndOffsets, int32(m.End))
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+	return q.CreateChirpMentions(ctx, params)
+}
+
+func (cfg *apiConfig) mentionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsRead)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// newest first
+	chirps, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.Chirp, error) {
+		if forward {
+			return cfg.Queries.ListMentionsDesc(r.Context(), database.ListMentionsDescParams{
+				UserID:          userID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		return cfg.Queries.ListMentionsAsc(r.Context(), database.ListMentionsAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+	}, chirpCursor)
+	if err != nil {
+		log.Printf("Error listing mentions: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// fill in counts and the caller's likes
+	chirpSlice, err := cfg.renderChirps(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirpSlice,
+		Next:   next,
+		Prev:   prev,
+	})
+
+}
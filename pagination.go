@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageCursor is the keyset position a page starts after. It is handed to
+// clients as an opaque base64 string.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Rank      float32   `json:"r,omitempty"`
+	Backward  bool      `json:"b,omitempty"`
+	Desc      bool      `json:"d,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	dat, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c pageCursor
+	if err := json.Unmarshal(dat, &c); err != nil || c.ID == uuid.Nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// createdAt, rank and id are the cursor fields as query parameters; all are
+// null when there is no cursor.
+func (c *pageCursor) createdAt() sql.NullTime {
+	if c == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: c.CreatedAt, Valid: true}
+}
+
+func (c *pageCursor) rank() sql.NullFloat64 {
+	if c == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(c.Rank), Valid: true}
+}
+
+func (c *pageCursor) id() uuid.NullUUID {
+	if c == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: c.ID, Valid: true}
+}
+
+// parsePageParams reads the limit and cursor query parameters.
+func parsePageParams(r *http.Request) (int32, *pageCursor, error) {
+	limit := int32(defaultPageLimit)
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return 0, nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		limit = int32(n)
+	}
+
+	var cur *pageCursor
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			return 0, nil, err
+		}
+		cur = c
+	}
+
+	return limit, cur, nil
+}
+
+// fetchPage loads one page of rows in the listing's natural order. fetch is
+// called with forward=true to read rows following cur in that order and
+// forward=false to read rows preceding it (nearest first); it is asked for
+// one row more than limit so we can tell whether another page exists. key
+// returns the cursor position of a row.
+func fetchPage[T any](limit int32, cur *pageCursor, fetch func(cur *pageCursor, forward bool, limit int32) ([]T, error), key func(T) pageCursor) (rows []T, next, prev *string, err error) {
+	forward := cur == nil || !cur.Backward
+
+	rows, err = fetch(cur, forward, limit+1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// an extra row means there is more in the direction we read
+	more := len(rows) > int(limit)
+	if more {
+		rows = rows[:limit]
+	}
+
+	// backward reads come back nearest first, so flip them into page order
+	if !forward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if len(rows) == 0 {
+		return rows, nil, nil, nil
+	}
+
+	if more || !forward {
+		c := key(rows[len(rows)-1])
+		s := c.encode()
+		next = &s
+	}
+	if (more && !forward) || (forward && cur != nil) {
+		c := key(rows[0])
+		c.Backward = true
+		s := c.encode()
+		prev = &s
+	}
+
+	return rows, next, prev, nil
+}
+
+func chirpCursor(c database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: c.CreatedAt, ID: c.ID}
+}
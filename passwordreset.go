@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// passwordResetTimeout bounds the lookup and bookkeeping done for a
+	// reset request after it has been answered.
+	passwordResetTimeout = 30 * time.Second
+)
+
+func (cfg *apiConfig) requestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	// decode the email
+	var params struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// the answer is the same whether or not the account exists, and it goes
+	// out before we look, so the response time gives nothing away either
+	w.WriteHeader(202)
+	go cfg.startPasswordReset(r.WithContext(context.WithoutCancel(r.Context())), strings.TrimSpace(params.Email))
+
+}
+
+// startPasswordReset mails a reset token to the account with email, if there
+// is one that may sign in. It runs after the response has been sent; r is
+// only used for logging.
+func (cfg *apiConfig) startPasswordReset(r *http.Request, email string) {
+	ctx, cancel := context.WithTimeout(r.Context(), passwordResetTimeout)
+	defer cancel()
+
+	user, err := cfg.Queries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error locating user: %s", err)
+		return
+	}
+	if user.BannedAt.Valid {
+		return
+	}
+
+	// a new link replaces any outstanding ones
+	tok, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making reset token: %s", err)
+		return
+	}
+	err = cfg.Queries.DeleteExpiredPasswordResets(ctx)
+	if err != nil {
+		log.Printf("Error pruning password resets: %s", err)
+	}
+	err = cfg.Queries.DeletePasswordResets(ctx, user.ID)
+	if err == nil {
+		err = cfg.Queries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+			TokenHash: hashToken(tok),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(passwordResetTTL),
+		})
+	}
+	if err != nil {
+		log.Printf("Error creating password reset: %s", err)
+		return
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"To choose a new password, send this token to POST /api/password-reset/confirm within the next hour:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n", tok),
+	})
+	logSecurityEvent(r, "password_reset_requested", user.ID, "")
+}
+
+func (cfg *apiConfig) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	// decode the token and new password
+	var params struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+	pwd := strings.TrimSpace(params.Password)
+	if pwd == "" {
+		respondWithJSON(w, 400, errorResponse{Error: "password is required"})
+		return
+	}
+
+	// checked before the token is spent, so a weak password can be retried
+	owner, err := cfg.Queries.GetPasswordResetUser(r.Context(), hashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 400, errorResponse{Error: "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up password reset: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if !cfg.acceptablePassword(w, pwd, owner.Email, owner.Username.String) {
+		return
+	}
+
+	// hash before spending the token; it is slow on purpose
+	hash, err := auth.HashPassword(pwd)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// the token is only spent if the new password sticks
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	// the token works once
+	userID, err := qtx.UsePasswordReset(r.Context(), hashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 400, errorResponse{Error: "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error using password reset: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// set the new password
+	err = qtx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hash,
+	})
+	if err != nil {
+		log.Printf("Error setting password: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// whoever had the old password is signed out everywhere, and loses any
+	// tokens they made with it
+	err = qtx.DeletePasswordResets(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting password resets: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	err = qtx.DeleteAPITokensForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting API tokens: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	revoked, err := revokeAllSessions(r.Context(), qtx, userID)
+	if err != nil {
+		log.Printf("Error ending sessions: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing password reset: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	cfg.Denylist.remember(revoked)
+	logSecurityEvent(r, "password_reset", userID, "")
+
+	w.WriteHeader(204)
+
+}
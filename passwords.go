@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/password"
+)
+
+// passwordPolicyResponse is a 400 listing everything wrong with a password.
+type passwordPolicyResponse struct {
+	Error      string               `json:"error"`
+	Violations []password.Violation `json:"violations"`
+}
+
+// loadPasswordChecker builds the password policy from the environment:
+// PASSWORD_MIN_LENGTH and PASSWORD_MIN_SCORE override the defaults, and
+// BREACHED_PASSWORDS_DIR points at a local breached-password list in range
+// file form.
+func loadPasswordChecker() (*password.Checker, error) {
+	c := &password.Checker{Policy: password.DefaultPolicy}
+
+	for _, v := range []struct {
+		env string
+		dst *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &c.Policy.MinLength},
+		{"PASSWORD_MIN_SCORE", &c.Policy.MinScore},
+	} {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer", v.env)
+		}
+		*v.dst = n
+	}
+
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		breaches, err := password.NewRangeDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		c.Breaches = breaches
+	}
+	return c, nil
+}
+
+// loadPasswordHashing applies ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and
+// ARGON2_PARALLELISM to new password hashes. Unset ones keep their defaults.
+// Raising them upgrades each user's hash the next time they log in.
+func loadPasswordHashing() error {
+	memory, iterations, parallelism := auth.PasswordParams()
+	for _, v := range []struct {
+		env string
+		max uint64
+		set func(uint64)
+	}{
+		{"ARGON2_MEMORY", math.MaxUint32, func(n uint64) { memory = uint32(n) }},
+		{"ARGON2_ITERATIONS", math.MaxUint32, func(n uint64) { iterations = uint32(n) }},
+		{"ARGON2_PARALLELISM", math.MaxUint8, func(n uint64) { parallelism = uint8(n) }},
+	} {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || n > v.max {
+			return fmt.Errorf("%s must be a positive integer, at most %d", v.env, v.max)
+		}
+		v.set(n)
+	}
+	return auth.SetPasswordParams(memory, iterations, parallelism)
+}
+
+// upgradePasswordHash rehashes pwd with the current argon2id settings if
+// hash was made with weaker ones. It runs after a successful login, the only
+// time the plain password is at hand. Failing just means trying again next
+// time, so errors are only logged.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, userID uuid.UUID, pwd, hash string) {
+	stale, err := auth.NeedsRehash(hash)
+	if err != nil || !stale {
+		return
+	}
+	newHash, err := auth.HashPassword(pwd)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	// only replace the hash we checked, in case the password just changed
+	_, err = cfg.Queries.RehashPassword(ctx, database.RehashPasswordParams{
+		ID:      userID,
+		NewHash: newHash,
+		OldHash: hash,
+	})
+	if err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
+
+// acceptablePassword checks a new password against the policy, writing a
+// 400 with the violations if it falls short. userInputs are the user's own
+// details, like their email, which make a password weaker if it contains
+// them.
+func (cfg *apiConfig) acceptablePassword(w http.ResponseWriter, pwd string, userInputs ...string) bool {
+	violations, err := cfg.Passwords.Check(pwd, userInputs...)
+	if err != nil {
+		log.Printf("Error checking password: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return false
+	}
+	if len(violations) > 0 {
+		respondWithJSON(w, 400, passwordPolicyResponse{
+			Error:      "Password does not meet the requirements",
+			Violations: violations,
+		})
+		return false
+	}
+	return true
+}
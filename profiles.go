@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxURLLength         = 2048
+)
+
+// Profile is the public view of a user; it never includes the email.
+type Profile struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Username       *string    `json:"username"`
+	DisplayName    *string    `json:"display_name"`
+	Bio            *string    `json:"bio"`
+	Location       *string    `json:"location"`
+	Website        *string    `json:"website"`
+	AvatarURL      *string    `json:"avatar_url"`
+	AvatarMediaID  *uuid.UUID `json:"avatar_media_id"`
+	IsChirpyRed    bool       `json:"is_chirpy_red"`
+	FollowerCount  int64      `json:"follower_count"`
+	FollowingCount int64      `json:"following_count"`
+	ChirpCount     int64      `json:"chirp_count"`
+}
+
+// profile loads a user's public profile. An uploaded avatar takes the place
+// of an external avatar_url.
+func (cfg *apiConfig) profile(ctx context.Context, id uuid.UUID) (Profile, error) {
+	p, err := cfg.Queries.GetUserProfile(ctx, id)
+	if err != nil {
+		return Profile{}, err
+	}
+	profile := Profile{
+		ID:             p.ID,
+		CreatedAt:      p.CreatedAt,
+		Username:       nullStringPtr(p.Username),
+		DisplayName:    nullStringPtr(p.DisplayName),
+		Bio:            nullStringPtr(p.Bio),
+		Location:       nullStringPtr(p.Location),
+		Website:        nullStringPtr(p.Website),
+		AvatarURL:      nullStringPtr(p.AvatarUrl),
+		IsChirpyRed:    p.IsChirpyRed,
+		FollowerCount:  p.FollowerCount,
+		FollowingCount: p.FollowingCount,
+		ChirpCount:     p.ChirpCount,
+	}
+	if p.AvatarMediaID.Valid {
+		url := mediaURL(p.AvatarMediaID.UUID)
+		profile.AvatarURL = &url
+		profile.AvatarMediaID = &p.AvatarMediaID.UUID
+	}
+	return profile, nil
+}
+
+// respondWithProfile writes the profile of user id, or a 404 if there is no
+// such user.
+func (cfg *apiConfig) respondWithProfile(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	profile, err := cfg.profile(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting profile: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	respondWithJSON(w, 200, profile)
+}
+
+// profileText applies a patch to a free-text profile field: nil keeps the
+// current value and an empty string clears it.
+func profileText(current sql.NullString, patch *string, field string, maxLen int) (sql.NullString, error) {
+	if patch == nil {
+		return current, nil
+	}
+	s := strings.TrimSpace(*patch)
+	if s == "" {
+		return sql.NullString{}, nil
+	}
+	if utf8.RuneCountInString(s) > maxLen {
+		return current, fmt.Errorf("%s must be at most %d characters", field, maxLen)
+	}
+	return sql.NullString{String: s, Valid: true}, nil
+}
+
+// profileURL is profileText for fields that must be http(s) links.
+func profileURL(current sql.NullString, patch *string, field string) (sql.NullString, error) {
+	v, err := profileText(current, patch, field, maxURLLength)
+	if err != nil || patch == nil || !v.Valid {
+		return v, err
+	}
+	u, err := url.Parse(v.String)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return current, fmt.Errorf("%s must be an http or https URL", field)
+	}
+	return v, nil
+}
+
+func (cfg *apiConfig) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+
+	// parse user id
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse user id"})
+		return
+	}
+
+	cfg.respondWithProfile(w, r, id)
+
+}
+
+func (cfg *apiConfig) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeProfileWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// omitted fields are left alone
+	type parameters struct {
+		DisplayName   *string `json:"display_name"`
+		Bio           *string `json:"bio"`
+		Location      *string `json:"location"`
+		Website       *string `json:"website"`
+		AvatarURL     *string `json:"avatar_url"`
+		AvatarMediaID *string `json:"avatar_media_id"`
+	}
+
+	// decode the request body
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJSON(w, 400, errorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	// start from the current profile
+	current, err := cfg.Queries.GetUserProfile(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting profile: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// apply and validate the patch
+	update := database.UpdateUserProfileParams{ID: userID}
+	var errs [5]error
+	update.DisplayName, errs[0] = profileText(current.DisplayName, params.DisplayName, "display_name", maxDisplayNameLength)
+	update.Bio, errs[1] = profileText(current.Bio, params.Bio, "bio", maxBioLength)
+	update.Location, errs[2] = profileText(current.Location, params.Location, "location", maxLocationLength)
+	update.Website, errs[3] = profileURL(current.Website, params.Website, "website")
+	update.AvatarUrl, errs[4] = profileURL(current.AvatarUrl, params.AvatarURL, "avatar_url")
+	if err := errors.Join(errs[:]...); err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// an uploaded avatar has to be one of the user's own images; an empty
+	// id goes back to avatar_url
+	update.AvatarMediaID = current.AvatarMediaID
+	if params.AvatarMediaID != nil && *params.AvatarMediaID == "" {
+		update.AvatarMediaID = uuid.NullUUID{}
+	} else if params.AvatarMediaID != nil {
+		id, err := uuid.Parse(*params.AvatarMediaID)
+		if err != nil {
+			respondWithJSON(w, 400, errorResponse{Error: "avatar_media_id: unable to parse media id"})
+			return
+		}
+		err = cfg.ownMedia(r.Context(), userID, id)
+		if errors.Is(err, errNotOwnMedia) {
+			respondWithJSON(w, 400, errorResponse{Error: "avatar_media_id: " + err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking avatar media: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+		update.AvatarMediaID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	// save it
+	err = cfg.Queries.UpdateUserProfile(r.Context(), update)
+	if err != nil {
+		log.Printf("Error updating profile: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// a replaced avatar may now be unused
+	if current.AvatarMediaID.Valid && current.AvatarMediaID != update.AvatarMediaID {
+		err = releaseMedia(r.Context(), cfg.Queries, []uuid.UUID{current.AvatarMediaID.UUID})
+		if err != nil {
+			log.Printf("Error releasing old avatar: %s", err)
+		}
+	}
+
+	cfg.respondWithProfile(w, r, userID)
+
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/ratelimit"
+)
+
+// ratePolicy is the limit for a group of routes. Anonymous callers are
+// counted per address, signed-in users per account, and Chirpy Red users get
+// more room. A perAddress policy always counts by address.
+type ratePolicy struct {
+	name       string
+	anon       ratelimit.Limit
+	user       ratelimit.Limit
+	red        ratelimit.Limit
+	perAddress bool
+}
+
+func perMinute(n int) ratelimit.Limit {
+	return ratelimit.Limit{Requests: n, Period: time.Minute}
+}
+
+var (
+	readPolicy  = ratePolicy{name: "read", anon: perMinute(120), user: perMinute(300), red: perMinute(600)}
+	writePolicy = ratePolicy{name: "write", anon: perMinute(30), user: perMinute(60), red: perMinute(120)}
+	chirpPolicy = ratePolicy{name: "chirp", anon: perMinute(10), user: perMinute(10), red: perMinute(30)}
+	mediaPolicy = ratePolicy{name: "media", anon: perMinute(5), user: perMinute(10), red: perMinute(30)}
+
+	// credential endpoints are limited by address whoever is asking
+	authPolicy = ratePolicy{name: "auth", anon: perMinute(10), perAddress: true}
+)
+
+// routePolicies maps a route pattern to its policy. Other GET routes use
+// readPolicy and everything else writePolicy.
+var routePolicies = map[string]ratePolicy{
+	"GET /api/healthz":                    {},
+	"POST /api/chirps":                    chirpPolicy,
+	"PUT /api/chirps/{chirpID}":           chirpPolicy,
+	"POST /api/chirps/{chirpID}/rechirp":  chirpPolicy,
+	"POST /api/media":                     mediaPolicy,
+	"POST /api/users":                     authPolicy,
+	"POST /api/login":                     authPolicy,
+	"POST /api/login/2fa":                 authPolicy,
+	"POST /api/password-reset/request":    authPolicy,
+	"POST /api/password-reset/confirm":    authPolicy,
+	"POST /api/users/verify-email/resend": authPolicy,
+}
+
+const (
+	rateLimitPruneInterval = time.Minute
+	chirpyRedCacheTTL      = time.Minute
+)
+
+// chirpyRedCache remembers who has Chirpy Red for a short while, so picking
+// a limit doesn't cost a query on every request. Entries past the TTL are
+// pruned, so it only ever holds recently active users.
+type chirpyRedCache struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]chirpyRedEntry
+}
+
+type chirpyRedEntry struct {
+	red     bool
+	checked time.Time
+}
+
+func (cfg *apiConfig) isChirpyRed(ctx context.Context, userID uuid.UUID) bool {
+	c := cfg.RedCache
+	c.mu.Lock()
+	e, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && time.Since(e.checked) < chirpyRedCacheTTL {
+		return e.red
+	}
+
+	user, err := cfg.Queries.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting user for rate limit: %s", err)
+		return false
+	}
+	c.mu.Lock()
+	c.entries[userID] = chirpyRedEntry{red: user.IsChirpyRed, checked: time.Now()}
+	c.mu.Unlock()
+	return user.IsChirpyRed
+}
+
+func (c *chirpyRedCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, e := range c.entries {
+		if time.Since(e.checked) >= chirpyRedCacheTTL {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// rateLimitKey picks the bucket for a request and its limit. An access
+// token's signature is enough to trust its subject here; a personal access
+// token is looked up by its hash first. Until a token checks out the
+// request counts against its address, so made-up tokens can't buy fresh
+// buckets.
+func (cfg *apiConfig) rateLimitKey(r *http.Request, policy ratePolicy) (string, ratelimit.Limit) {
+	anon := policy.name + ":ip:" + clientIP(r)
+	if policy.perAddress {
+		return anon, policy.anon
+	}
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return anon, policy.anon
+	}
+	var userID uuid.UUID
+	if auth.IsAPIToken(tok) {
+		t, err := cfg.lookupAPIToken(r.Context(), tok)
+		if err != nil {
+			return anon, policy.anon
+		}
+		userID = t.UserID
+	} else {
+		userID, err = cfg.Keys.ValidateJWT(tok)
+		if err != nil {
+			return anon, policy.anon
+		}
+	}
+	if cfg.isChirpyRed(r.Context(), userID) {
+		return policy.name + ":user:" + userID.String(), policy.red
+	}
+	return policy.name + ":user:" + userID.String(), policy.user
+}
+
+// middlewareRateLimit applies the route's policy to every request the mux
+// would serve. A failing store lets requests through rather than take the
+// API down with it.
+func (cfg *apiConfig) middlewareRateLimit(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.RateLimits == nil {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// pick the policy
+		_, pattern := mux.Handler(r)
+		policy, ok := routePolicies[pattern]
+		if !ok && r.Method == http.MethodGet {
+			policy = readPolicy
+		} else if !ok {
+			policy = writePolicy
+		}
+		if policy.name == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// and whose bucket this is
+		key, limit := cfg.rateLimitKey(r, policy)
+		res, err := cfg.RateLimits.Take(r.Context(), key, limit)
+		if err != nil {
+			log.Printf("Error checking rate limit: %s", err)
+			mux.ServeHTTP(w, r)
+			return
+		}
+		ratelimit.WriteHeaders(w, res)
+		if !res.Allowed {
+			respondWithJSON(w, 429, errorResponse{Error: "Too many requests"})
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// runRateLimitPruner keeps an in-memory store, and the Chirpy Red cache,
+// from growing without bound.
+func runRateLimitPruner(ctx context.Context, m *ratelimit.Memory, red *chirpyRedCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Prune()
+			red.prune()
+		}
+	}
+}
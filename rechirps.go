@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) rechirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// a rechirp is a post too
+	if !cfg.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// rechirping a rechirp reposts the original
+	original, err := cfg.originalChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// each user rechirps a chirp at most once
+	params := database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+	status := 201
+	rechirp, err := cfg.Queries.CreateRechirp(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		status = 200
+		rechirp, err = cfg.Queries.GetRechirp(r.Context(), database.GetRechirpParams(params))
+	}
+	if err != nil {
+		log.Printf("Error creating rechirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// render with the original embedded
+	response, err := cfg.renderChirp(r.Context(), rechirp, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Error rendering chirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, status, response)
+
+}
+
+func (cfg *apiConfig) unrechirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authorize(r, scopeChirpsWrite)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// undoing a rechirp that doesn't exist is a no-op
+	_, err = cfg.Queries.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error deleting rechirp: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+const (
+	maxThreadDepth   = 50
+	maxThreadReplies = 1000
+)
+
+// threadNode is a chirp along with the replies below it.
+type threadNode struct {
+	Chirp
+	Replies []*threadNode `json:"replies"`
+}
+
+type chirpThread struct {
+	Ancestors []Chirp     `json:"ancestors"`
+	Chirp     *threadNode `json:"chirp"`
+}
+
+// removeChirp deletes a chirp. A chirp that has replies or quotes is kept as
+// a tombstone so the conversation around it stays connected; tombstones left
+// with nothing pointing at them are cleaned up on the way back up the thread.
+// Either way its media are released for collection. It all happens in one
+// transaction with the chirp's row locked, so a reply or quote can't slip in
+// between the dependents check and the delete.
+func (cfg *apiConfig) removeChirp(ctx context.Context, chirpID uuid.UUID) error {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	// someone else may have got here first
+	chirp, err := qtx.GetChirpForUpdate(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirp.DeletedAt.Valid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mediaIDs, err := qtx.DetachChirpMedia(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+	err = deleteOrTombstone(ctx, qtx, chirp)
+	if err != nil {
+		return err
+	}
+	err = releaseMedia(ctx, qtx, mediaIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteOrTombstone(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	hasDependents, err := q.ChirpHasDependents(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+	if hasDependents {
+		// plain rechirps have nothing to show without the original
+		err = q.DeleteRechirpsOf(ctx, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+		if err != nil {
+			return err
+		}
+		// nor should earlier versions of the deleted text survive
+		err = q.DeleteChirpRevisions(ctx, chirp.ID)
+		if err != nil {
+			return err
+		}
+		// and a tombstone has no tags or mentions
+		err = unindexChirp(ctx, q, chirp.ID)
+		if err != nil {
+			return err
+		}
+		return q.TombstoneChirp(ctx, chirp.ID)
+	}
+
+	err = q.DeleteChirp(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	// a quoted tombstone may have just lost its last quote
+	if chirp.QuoteOf.Valid {
+		_, err = q.PruneTombstone(ctx, chirp.QuoteOf.UUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	parentID := chirp.InReplyTo
+	for parentID.Valid {
+		parent, err := q.GetOneChirp(ctx, parentID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pruned, err := q.PruneTombstone(ctx, parent.ID)
+		if err != nil || pruned == 0 {
+			return err
+		}
+		parentID = parent.InReplyTo
+	}
+	return nil
+}
+
+func (cfg *apiConfig) repliesHandler(w http.ResponseWriter, r *http.Request) {
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// make sure the chirp exists, tombstones included
+	_, err = cfg.Queries.GetOneChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// replies read oldest first, like a conversation
+	parentID := uuid.NullUUID{UUID: chirpID, Valid: true}
+	chirps, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.Chirp, error) {
+		if forward {
+			return cfg.Queries.ListRepliesAsc(r.Context(), database.ListRepliesAscParams{
+				ChirpID:         parentID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		return cfg.Queries.ListRepliesDesc(r.Context(), database.ListRepliesDescParams{
+			ChirpID:         parentID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+	}, chirpCursor)
+	if err != nil {
+		log.Printf("Error listing replies: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// fill in counts and the caller's likes
+	chirpSlice, err := cfg.renderChirps(r.Context(), chirps, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirpSlice,
+		Next:   next,
+		Prev:   prev,
+	})
+
+}
+
+func (cfg *apiConfig) threadHandler(w http.ResponseWriter, r *http.Request) {
+
+	// get chirp id from request
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse chirp id"})
+		return
+	}
+
+	// the chirp itself, which may be a tombstone
+	chirp, err := cfg.Queries.GetOneChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, 500, errorResponse{Error: "Internal error"})
+		return
+	}
+
+	// everything above it, root first
+	ancestors, err := cfg.Queries.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ChirpID:  chirpID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		log.Printf("Error fetching ancestors: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// everything below it, oldest first
+	descendants, err := cfg.Queries.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ChirpID:  uuid.NullUUID{UUID: chirpID, Valid: true},
+		MaxDepth: maxThreadDepth,
+		MaxRows:  maxThreadReplies,
+	})
+	if err != nil {
+		log.Printf("Error fetching descendants: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// render the whole thread in one batch: the chirp, then its ancestors, then its replies
+	all := make([]database.Chirp, 0, 1+len(ancestors)+len(descendants))
+	all = append(all, chirp)
+	all = append(all, ancestors...)
+	all = append(all, descendants...)
+	rendered, err := cfg.renderChirps(r.Context(), all, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// hang each reply off its parent; since replies are newer than what they
+	// reply to, parents are always seen first
+	root := &threadNode{Chirp: rendered[0], Replies: []*threadNode{}}
+	nodes := map[uuid.UUID]*threadNode{chirp.ID: root}
+	for i, c := range descendants {
+		parent, ok := nodes[c.InReplyTo.UUID]
+		if !ok {
+			continue
+		}
+		node := &threadNode{Chirp: rendered[1+len(ancestors)+i], Replies: []*threadNode{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[c.ID] = node
+	}
+
+	respondWithJSON(w, 200, chirpThread{
+		Ancestors: rendered[1 : 1+len(ancestors)],
+		Chirp:     root,
+	})
+
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/database"
+	"github.com/jonathangibson/chirpy/internal/search"
+)
+
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// build the text query
+	query, err := search.ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// optional author filter
+	var authorID uuid.NullUUID
+	if idStr := r.URL.Query().Get("author_id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			respondWithJSON(w, 400, errorResponse{Error: "Invalid user id"})
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	// page size and position
+	limit, cur, err := parsePageParams(r)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// best matches first, newest first among equal ranks
+	results, next, prev, err := fetchPage(limit, cur, func(cur *pageCursor, forward bool, limit int32) ([]database.SearchChirpsDescRow, error) {
+		if forward {
+			return cfg.Queries.SearchChirpsDesc(r.Context(), database.SearchChirpsDescParams{
+				Query:           query,
+				AuthorID:        authorID,
+				CursorCreatedAt: cur.createdAt(),
+				CursorRank:      cur.rank(),
+				CursorID:        cur.id(),
+				PageLimit:       limit,
+			})
+		}
+		rows, err := cfg.Queries.SearchChirpsAsc(r.Context(), database.SearchChirpsAscParams{
+			Query:           query,
+			AuthorID:        authorID,
+			CursorCreatedAt: cur.createdAt(),
+			CursorRank:      cur.rank(),
+			CursorID:        cur.id(),
+			PageLimit:       limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out := make([]database.SearchChirpsDescRow, 0, len(rows))
+		for _, row := range rows {
+			out = append(out, database.SearchChirpsDescRow(row))
+		}
+		return out, nil
+	}, func(row database.SearchChirpsDescRow) pageCursor {
+		return pageCursor{CreatedAt: row.Chirp.CreatedAt, ID: row.Chirp.ID, Rank: row.Rank}
+	})
+	if err != nil {
+		log.Printf("Error searching chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	// fill in counts and the caller's likes
+	rows := make([]database.Chirp, 0, len(results))
+	for _, row := range results {
+		rows = append(rows, row.Chirp)
+	}
+	chirps, err := cfg.renderChirps(r.Context(), rows, cfg.optionalUserID(r))
+	if err != nil {
+		log.Printf("Error rendering chirps: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, chirpPage{
+		Chirps: chirps,
+		Next:   next,
+		Prev:   prev,
+	})
+
+}
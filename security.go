@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+)
+
+// refreshTokenTTL is how long a refresh token lasts without being used.
+const refreshTokenTTL = 60 * 24 * time.Hour
+
+// maxUserAgentLength keeps a hostile client from storing an essay per session.
+const maxUserAgentLength = 512
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return ua
+}
+
+// loadKeySet builds the JWT keys from the environment. With a key directory,
+// tokens are signed by the PEM key named signingID and any other key in the
+// directory is still accepted. secret, if also set, keeps HS256 tokens issued
+// before the switch working, but only until legacyUntil (RFC 3339), which is
+// then required; once that has passed SECRET and LEGACY_SECRET_UNTIL can be
+// removed. Without a directory, tokens are HS256 with secret as before.
+func loadKeySet(secret, dir, signingID, legacyUntil string) (*auth.KeySet, error) {
+	if dir == "" {
+		if secret == "" {
+			return nil, errors.New("SECRET is empty")
+		}
+		return auth.NewKeySet("", auth.NewHMACKey("", []byte(secret)))
+	}
+
+	if signingID == "" {
+		return nil, errors.New("JWT_SIGNING_KEY_ID is empty")
+	}
+	keys, err := auth.LoadKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the old shared secret only verifies, and only for a while
+	if secret != "" {
+		if legacyUntil == "" {
+			return nil, errors.New("LEGACY_SECRET_UNTIL is required when SECRET is set alongside JWT_KEYS_DIR")
+		}
+		until, err := time.Parse(time.RFC3339, legacyUntil)
+		if err != nil {
+			return nil, fmt.Errorf("LEGACY_SECRET_UNTIL: %w", err)
+		}
+		legacy := auth.NewHMACKey("", []byte(secret))
+		legacy.NotAfter = until
+		keys = append(keys, legacy)
+	}
+
+	return auth.NewKeySet(signingID, keys...)
+}
+
+// jwksHandler publishes the public keys that verify our access tokens, so
+// other services can check them without the signing key.
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, 200, cfg.Keys.JWKS())
+}
+
+// hashToken is how bearer secrets that only need an exact-match lookup are
+// stored. They're long and random, so a fast hash is enough.
+func hashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+// logSecurityEvent records something an operator may need to act on, such as
+// signs that a token was stolen. Lines are prefixed so they're easy to grep.
+func logSecurityEvent(r *http.Request, event string, userID uuid.UUID, format string, args ...any) {
+	log.Printf("SECURITY %s user=%s remote=%s %s", event, userID, r.RemoteAddr, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+// Session is one login, which lives on through refresh token rotations.
+// Its ID is the refresh token family.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	SignedInAt time.Time  `json:"signed_in_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+// startSession signs userID in from the device making the request,
+// returning an access token and the first refresh token of a new session.
+func (cfg *apiConfig) startSession(r *http.Request, userID uuid.UUID) (string, string, error) {
+	tok, claims, err := cfg.Keys.Issue(userID, time.Duration(time.Hour))
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshTok, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	// the refresh token starts a new family
+	_, err = cfg.Queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:  refreshTok,
+		UserID: userID,
+		ExpiresAt: sql.NullTime{
+			Time:  time.Now().Add(refreshTokenTTL),
+			Valid: true,
+		},
+		FamilyID:        uuid.New(),
+		UserAgent:       userAgent(r),
+		IpAddress:       clientIP(r),
+		AccessJti:       uuid.NullUUID{UUID: claims.TokenID, Valid: true},
+		AccessExpiresAt: sql.NullTime{Time: claims.ExpiresAt, Valid: true},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return tok, refreshTok, nil
+}
+
+// endSession revokes every refresh token in a session and the access tokens
+// issued with them.
+func (cfg *apiConfig) endSession(ctx context.Context, familyID uuid.UUID) error {
+	rows, err := cfg.Queries.RevokeRefreshTokenFamily(ctx, familyID)
+	if err != nil {
+		return err
+	}
+	var toks accessTokens
+	for _, row := range rows {
+		toks.add(row.AccessJti, row.AccessExpiresAt)
+	}
+	return cfg.Denylist.revoke(ctx, toks)
+}
+
+// endUserSession is endSession for a session that must belong to userID. It
+// reports whether there was a live session to end.
+func (cfg *apiConfig) endUserSession(ctx context.Context, userID, familyID uuid.UUID) (bool, error) {
+	rows, err := cfg.Queries.RevokeSession(ctx, database.RevokeSessionParams{
+		FamilyID: familyID,
+		UserID:   userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	var toks accessTokens
+	for _, row := range rows {
+		toks.add(row.AccessJti, row.AccessExpiresAt)
+	}
+	return len(rows) > 0, cfg.Denylist.revoke(ctx, toks)
+}
+
+// endAllSessions logs userID out everywhere.
+func (cfg *apiConfig) endAllSessions(ctx context.Context, userID uuid.UUID) error {
+	toks, err := revokeAllSessions(ctx, cfg.Queries, userID)
+	if err != nil {
+		return err
+	}
+	cfg.Denylist.remember(toks)
+	return nil
+}
+
+// revokeAllSessions is endAllSessions through q, which may be part of a
+// transaction. Once it commits, pass the returned tokens to
+// Denylist.remember so they stop working on this server at once.
+func revokeAllSessions(ctx context.Context, q *database.Queries, userID uuid.UUID) (accessTokens, error) {
+	rows, err := q.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return accessTokens{}, err
+	}
+	var toks accessTokens
+	for _, row := range rows {
+		toks.add(row.AccessJti, row.AccessExpiresAt)
+	}
+	return toks, recordRevoked(ctx, q, toks)
+}
+
+func (cfg *apiConfig) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// live sessions, most recently used first
+	rows, err := cfg.Queries.ListSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing sessions: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, sessionFromDB(row))
+	}
+
+	respondWithJSON(w, 200, sessions)
+
+}
+
+func sessionFromDB(row database.ListSessionsRow) Session {
+	s := Session{
+		ID:         row.FamilyID,
+		SignedInAt: row.SignedInAt,
+		UserAgent:  row.UserAgent,
+		IPAddress:  row.IpAddress,
+	}
+	if row.LastUsedAt.Valid {
+		s.LastUsedAt = &row.LastUsedAt.Time
+	}
+	if row.ExpiresAt.Valid {
+		s.ExpiresAt = &row.ExpiresAt.Time
+	}
+	return s
+}
+
+func (cfg *apiConfig) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// parse session id
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "Unable to parse session id"})
+		return
+	}
+
+	// other users' sessions look the same as missing ones
+	found, err := cfg.endUserSession(r.Context(), userID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if !found {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
+
+func (cfg *apiConfig) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// log out everywhere
+	err = cfg.endAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(204)
+
+}
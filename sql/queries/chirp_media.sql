@@ -0,0 +1,18 @@
+-- name: AttachChirpMedia :exec
+INSERT INTO chirp_media (chirp_id, media_id, position, alt_text)
+SELECT sqlc.arg('chirp_id')::uuid,
+       unnest(sqlc.arg('media_ids')::uuid[]),
+       unnest(sqlc.arg('positions')::int[]),
+       unnest(sqlc.arg('alt_texts')::text[]);
+
+-- name: DetachChirpMedia :many
+DELETE FROM chirp_media
+WHERE chirp_id = $1
+RETURNING media_id;
+
+-- name: GetChirpMedia :many
+SELECT chirp_media.chirp_id, chirp_media.alt_text, sqlc.embed(media_files)
+FROM chirp_media
+JOIN media_files ON media_files.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position;
@@ -0,0 +1,25 @@
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at, attempts)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    0
+);
+
+-- name: AttemptLoginChallenge :one
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg('token_hash')
+  AND expires_at > NOW()
+  AND attempts < sqlc.arg('max_attempts')::int
+RETURNING user_id;
+
+-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges
+WHERE token_hash = $1;
+
+-- name: DeleteExpiredLoginChallenges :exec
+DELETE FROM login_challenges
+WHERE expires_at <= NOW();
@@ -0,0 +1,45 @@
+-- name: CreateMediaFile :one
+INSERT INTO media_files (
+    id,
+    created_at,
+    user_id,
+    content_type,
+    size_bytes,
+    width,
+    height,
+    storage_key,
+    thumbnail_key,
+    thumbnail_content_type
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+RETURNING *;
+
+-- name: GetMediaFile :one
+SELECT * FROM media_files
+WHERE id = $1;
+
+-- name: ReleaseMedia :exec
+UPDATE media_files
+SET released_at = NOW()
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+  AND NOT EXISTS (SELECT 1 FROM chirp_media WHERE chirp_media.media_id = media_files.id)
+  AND NOT EXISTS (SELECT 1 FROM users WHERE users.avatar_media_id = media_files.id);
+
+-- name: DeleteCollectableMedia :many
+DELETE FROM media_files
+WHERE (released_at < sqlc.arg('released_before')
+       OR (released_at IS NULL AND created_at < sqlc.arg('uploaded_before')))
+  AND NOT EXISTS (SELECT 1 FROM chirp_media WHERE chirp_media.media_id = media_files.id)
+  AND NOT EXISTS (SELECT 1 FROM users WHERE users.avatar_media_id = media_files.id)
+RETURNING storage_key, thumbnail_key;
@@ -0,0 +1,33 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    NULL
+);
+
+-- name: GetPasswordResetUser :one
+SELECT users.email, users.username
+FROM password_resets
+JOIN users ON users.id = password_resets.user_id
+WHERE password_resets.token_hash = $1
+  AND password_resets.used_at IS NULL
+  AND password_resets.expires_at > NOW();
+
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = NOW()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: DeletePasswordResets :exec
+DELETE FROM password_resets
+WHERE user_id = $1;
+
+-- name: DeleteExpiredPasswordResets :exec
+DELETE FROM password_resets
+WHERE expires_at <= NOW();
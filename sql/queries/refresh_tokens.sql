@@ -1,12 +1,18 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, last_used_at, access_jti, access_expires_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
 RETURNING *;
 
@@ -15,7 +21,47 @@ SELECT *
 FROM refresh_tokens
 WHERE token = $1;
 
--- name: RevokeRefreshToken :exec
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), replaced_by = $2, updated_at = NOW()
+WHERE token = $1
+  AND rotated_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW();
+
+-- name: RevokeRefreshTokenFamily :many
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE family_id = $1
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at;
+
+-- name: ListSessions :many
+SELECT
+    family_id,
+    (SELECT min(created_at) FROM refresh_tokens AS f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS signed_in_at,
+    last_used_at,
+    user_agent,
+    ip_address,
+    expires_at
+FROM refresh_tokens
+WHERE user_id = $1
+  AND rotated_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :many
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at;
+
+-- name: RevokeAllSessions :many
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL
+RETURNING access_jti, access_expires_at;
@@ -0,0 +1,15 @@
+-- name: RevokeAccessTokens :exec
+INSERT INTO revoked_tokens (jti, expires_at, revoked_at)
+SELECT unnest(sqlc.arg('jtis')::uuid[]),
+       unnest(sqlc.arg('expires_ats')::timestamp[]),
+       NOW()
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: ListRevokedAccessTokens :many
+SELECT jti, expires_at
+FROM revoked_tokens
+WHERE expires_at > NOW();
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at <= NOW();
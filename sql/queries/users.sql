@@ -1,41 +1,138 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
 -- name: GetUserByID :one
-SELECT id, email, created_at, updated_at, is_chirpy_red
+SELECT id, email, created_at, updated_at, is_chirpy_red, username, email_verified_at, pending_email
 FROM users
 WHERE id = $1;
 
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, banned_at, totp_enabled_at, email_verified_at, pending_email
 FROM users
 WHERE email = $1;
 
 -- name: DeleteUsers :exec
 DELETE FROM users;
 
--- name: GetUserFromRefreshToken :one
-SELECT users.*
+-- name: GetUserPasswordHash :one
+SELECT hashed_password
 FROM users
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
-  AND refresh_tokens.expires_at > NOW()
-  AND refresh_tokens.revoked_at IS NULL;
+WHERE id = $1;
+
+-- name: SetPendingEmail :exec
+UPDATE users
+SET pending_email = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyEmail :execrows
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND email = $2;
 
--- name: UpdateUser :exec
+-- name: ConfirmPendingEmail :execrows
 UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3;
+SET email = pending_email, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND pending_email = sqlc.arg('email');
 
 -- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1;
+
+-- name: GetUsersByUsernames :many
+SELECT id, username
+FROM users
+WHERE lower(username) = ANY(sqlc.arg('usernames')::text[]);
+
+-- name: GetUserIDByUsername :one
+SELECT id
+FROM users
+WHERE lower(username) = lower(sqlc.arg('username'));
+
+-- name: SetUsername :exec
+UPDATE users
+SET username = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserProfile :one
+SELECT
+    id,
+    created_at,
+    username,
+    display_name,
+    bio,
+    location,
+    website,
+    avatar_url,
+    avatar_media_id,
+    is_chirpy_red,
+    (SELECT count(*) FROM follows WHERE followee_id = users.id) AS follower_count,
+    (SELECT count(*) FROM follows WHERE follower_id = users.id) AS following_count,
+    (SELECT count(*) FROM chirps WHERE user_id = users.id AND deleted_at IS NULL) AS chirp_count
+FROM users
+WHERE id = $1;
+
+-- name: UpdateUserProfile :exec
+UPDATE users
+SET display_name = $2,
+    bio = $3,
+    location = $4,
+    website = $5,
+    avatar_url = $6,
+    avatar_media_id = $7,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserBanned :execrows
+UPDATE users
+SET banned_at = CASE WHEN sqlc.arg('banned')::bool THEN COALESCE(banned_at, NOW()) END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: GetUserTOTP :one
+SELECT totp_secret, totp_enabled_at, totp_last_counter, banned_at
+FROM users
+WHERE id = $1;
+
+-- name: SetPendingTOTP :execrows
+UPDATE users
+SET totp_secret = $2, totp_last_counter = NULL, updated_at = NOW()
+WHERE id = $1
+  AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_counter = $2, updated_at = NOW()
+WHERE id = $1
+  AND totp_secret IS NOT NULL
+  AND totp_enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_counter = $2
+WHERE id = $1
+  AND (totp_last_counter IS NULL OR totp_last_counter < $2);
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: RehashPassword :execrows
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = $1 AND hashed_password = sqlc.arg('old_hash');
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    hashtag_id UUID NOT NULL REFERENCES hashtags ON DELETE CASCADE,
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+
+CREATE INDEX chirp_hashtags_hashtag_id_idx ON chirp_hashtags (hashtag_id, chirp_id);
+
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT;
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (lower(username));
+
+-- +goose Down
+DROP INDEX users_username_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN username;
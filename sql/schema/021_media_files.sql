@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE media_files
+ADD COLUMN released_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE media_files
+DROP COLUMN released_at;
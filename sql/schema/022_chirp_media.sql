@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE chirp_media (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    media_id UUID NOT NULL REFERENCES media_files ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    alt_text TEXT NOT NULL,
+    PRIMARY KEY (chirp_id, media_id),
+    UNIQUE (chirp_id, position)
+);
+
+CREATE INDEX chirp_media_media_id_idx ON chirp_media (media_id);
+
+
+-- +goose Down
+DROP TABLE chirp_media;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN access_jti UUID,
+ADD COLUMN access_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN access_expires_at,
+DROP COLUMN access_jti;
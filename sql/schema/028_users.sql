@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT,
+ADD COLUMN totp_enabled_at TIMESTAMP,
+ADD COLUMN totp_last_counter BIGINT;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN totp_last_counter,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_secret;
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonathangibson/chirpy/internal/auth"
+	"github.com/jonathangibson/chirpy/internal/database"
+)
+
+const (
+	totpIssuer           = "Chirpy"
+	recoveryCodeCount    = 10
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+// loginChallenge is what loginHandler returns instead of tokens when the
+// user has 2FA on. The challenge token goes to POST /api/login/2fa along
+// with a code.
+type loginChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// secondFactor is a TOTP code or, failing that, a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (cfg *apiConfig) respondWithLoginChallenge(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	tok, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making challenge token: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	expiresAt := time.Now().Add(loginChallengeTTL)
+
+	// clear out abandoned challenges while we're here
+	err = cfg.Queries.DeleteExpiredLoginChallenges(r.Context())
+	if err != nil {
+		log.Printf("Error pruning login challenges: %s", err)
+	}
+
+	err = cfg.Queries.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{
+		TokenHash: hashToken(tok),
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error creating login challenge: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, loginChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    tok,
+		ExpiresAt:         expiresAt,
+	})
+}
+
+// checkSecondFactor verifies a TOTP or recovery code for userID, using it up
+// so it can't be presented again.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, secret string, f secondFactor) (bool, error) {
+	if f.Code != "" {
+		step, ok := auth.ValidateTOTP(secret, f.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// only the first use of a code counts
+		n, err := cfg.Queries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:              userID,
+			TotpLastCounter: sql.NullInt64{Int64: step, Valid: true},
+		})
+		return n == 1, err
+	}
+
+	if f.RecoveryCode == "" {
+		return false, nil
+	}
+	code := auth.NormalizeRecoveryCode(f.RecoveryCode)
+	codes, err := cfg.Queries.ListUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range codes {
+		match, err := auth.CheckPasswordHash(code, c.CodeHash)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			n, err := cfg.Queries.UseRecoveryCode(ctx, c.ID)
+			return n == 1, err
+		}
+	}
+	return false, nil
+}
+
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// the account name shown in the authenticator app
+	user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	account := user.Email
+	if user.Username.Valid {
+		account = user.Username.String
+	}
+
+	// a new secret replaces any unconfirmed one
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	n, err := cfg.Queries.SetPendingTOTP(r.Context(), database.SetPendingTOTPParams{
+		ID:         userID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error saving TOTP secret: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if n == 0 {
+		respondWithJSON(w, 409, errorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	respondWithJSON(w, 200, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, totpIssuer, account),
+	})
+
+}
+
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// decode the first code from the app
+	var params struct {
+		Code string `json:"code"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// there must be an enrollment waiting
+	totp, err := cfg.Queries.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting TOTP state: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if totp.TotpEnabledAt.Valid {
+		respondWithJSON(w, 409, errorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+	if !totp.TotpSecret.Valid {
+		respondWithJSON(w, 400, errorResponse{Error: "Start enrollment first"})
+		return
+	}
+
+	// proving the app is set up right
+	step, ok := auth.ValidateTOTP(totp.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithJSON(w, 400, errorResponse{Error: "Incorrect code"})
+		return
+	}
+
+	// recovery codes are shown once and stored hashed
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i], err = auth.HashPassword(c)
+		if err != nil {
+			log.Printf("Error hashing recovery code: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+	}
+
+	// turn 2FA on and store the codes together
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	n, err := qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		ID:              userID,
+		TotpLastCounter: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error enabling TOTP: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if n == 0 {
+		respondWithJSON(w, 409, errorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+	err = qtx.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting recovery codes: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	err = qtx.CreateRecoveryCodes(r.Context(), database.CreateRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		log.Printf("Error saving recovery codes: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing TOTP: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, map[string][]string{"recovery_codes": codes})
+
+}
+
+func (cfg *apiConfig) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+
+	// authenticate user
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		log.Printf("Error authenticating: %s", err)
+		respondWithJSON(w, 401, errorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// a stolen access token alone mustn't be enough to turn 2FA off
+	var params struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// both factors draw on the same guesses as the login challenge
+	if wait := cfg.Lockouts.reserveCode(userID); wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+
+	hash, err := cfg.Queries.GetUserPasswordHash(r.Context(), userID)
+	if err != nil {
+		cfg.Lockouts.releaseCode(userID)
+		log.Printf("Error getting password hash: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	match, err := auth.CheckPasswordHash(strings.TrimSpace(params.Password), hash)
+	if err != nil || !match {
+		cfg.failDisableTOTP(w, r, userID)
+		return
+	}
+
+	totp, err := cfg.Queries.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		cfg.Lockouts.releaseCode(userID)
+		log.Printf("Error getting TOTP state: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if !totp.TotpEnabledAt.Valid {
+		cfg.Lockouts.releaseCode(userID)
+		respondWithJSON(w, 409, errorResponse{Error: "Two-factor authentication is not enabled"})
+		return
+	}
+	ok, err := cfg.checkSecondFactor(r.Context(), userID, totp.TotpSecret.String, params.secondFactor)
+	if err != nil {
+		cfg.Lockouts.releaseCode(userID)
+		log.Printf("Error checking second factor: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if !ok {
+		cfg.failDisableTOTP(w, r, userID)
+		return
+	}
+	cfg.Lockouts.succeedCode(userID)
+
+	// turn it off and forget the recovery codes, together
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	err = qtx.DisableTOTP(r.Context(), userID)
+	if err == nil {
+		err = qtx.DeleteRecoveryCodes(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error disabling TOTP: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	logSecurityEvent(r, "totp_disabled", userID, "")
+
+	w.WriteHeader(204)
+
+}
+
+// failDisableTOTP records a wrong password or code sent to disable 2FA.
+func (cfg *apiConfig) failDisableTOTP(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	if wait := cfg.Lockouts.failCode(userID); wait > 0 {
+		logSecurityEvent(r, "totp_locked", userID, "for %s", wait)
+	}
+	respondWithJSON(w, 401, errorResponse{Error: "Incorrect password or code"})
+}
+
+// loginTwoFactorHandler finishes a login that loginHandler answered with a
+// challenge.
+func (cfg *apiConfig) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+
+	// decode the challenge and code
+	var params struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithJSON(w, 400, errorResponse{Error: "invalid JSON"})
+		return
+	}
+
+	// each challenge gets a few guesses
+	userID, err := cfg.Queries.AttemptLoginChallenge(r.Context(), database.AttemptLoginChallengeParams{
+		TokenHash:   hashToken(params.ChallengeToken),
+		MaxAttempts: maxChallengeAttempts,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 401, errorResponse{Error: "Challenge expired, please log in again"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking login challenge: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	totp, err := cfg.Queries.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting TOTP state: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if totp.BannedAt.Valid {
+		respondWithJSON(w, 403, errorResponse{Error: "Account is suspended"})
+		return
+	}
+
+	// 2FA may have been turned off since the challenge was issued
+	if totp.TotpEnabledAt.Valid {
+		// wrong codes count against the account, whichever challenge they came with
+		if wait := cfg.Lockouts.reserveCode(userID); wait > 0 {
+			respondLockedOut(w, wait)
+			return
+		}
+		ok, err := cfg.checkSecondFactor(r.Context(), userID, totp.TotpSecret.String, params.secondFactor)
+		if err != nil {
+			cfg.Lockouts.releaseCode(userID)
+			log.Printf("Error checking second factor: %s", err)
+			respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+			return
+		}
+		if !ok {
+			if wait := cfg.Lockouts.failCode(userID); wait > 0 {
+				logSecurityEvent(r, "totp_locked", userID, "for %s", wait)
+			}
+			respondWithJSON(w, 401, errorResponse{Error: "Incorrect code"})
+			return
+		}
+		cfg.Lockouts.succeedCode(userID)
+	}
+
+	// the challenge is spent
+	err = cfg.Queries.DeleteLoginChallenge(r.Context(), hashToken(params.ChallengeToken))
+	if err != nil {
+		log.Printf("Error deleting login challenge: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	if params.RecoveryCode != "" {
+		logSecurityEvent(r, "recovery_code_used", userID, "")
+	}
+
+	// same response as a one-step login
+	user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+	tok, refreshTok, err := cfg.startSession(r, userID)
+	if err != nil {
+		log.Printf("error: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	respondWithJSON(w, 200, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		Username:      nullStringPtr(user.Username),
+		Token:         tok,
+		RefreshToken:  refreshTok,
+		IsUpgraded:    user.IsChirpyRed,
+	})
+
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jonathangibson/chirpy/internal/entities"
+	"github.com/lib/pq"
+)
+
+const minUsernameLength = 3
+
+// reservedUsernames can't be claimed, compared without regard to case. Most
+// would be confusing as @mentions or look like they speak for Chirpy.
+var reservedUsernames = map[string]struct{}{
+	"admin":         {},
+	"administrator": {},
+	"api":           {},
+	"app":           {},
+	"chirpy":        {},
+	"everyone":      {},
+	"help":          {},
+	"me":            {},
+	"mod":           {},
+	"moderator":     {},
+	"null":          {},
+	"root":          {},
+	"security":      {},
+	"settings":      {},
+	"staff":         {},
+	"support":       {},
+	"system":        {},
+}
+
+// validateUsername checks a username against the rules for handles: ASCII
+// letters, digits and underscores, a sensible length, not all digits, and
+// not reserved.
+func validateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > entities.MaxHandleLength {
+		return fmt.Errorf("username must be between %d and %d characters", minUsernameLength, entities.MaxHandleLength)
+	}
+
+	allDigits := true
+	for _, c := range username {
+		switch {
+		case '0' <= c && c <= '9':
+		case c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			allDigits = false
+		default:
+			return errors.New("username may only contain letters, numbers and underscores")
+		}
+	}
+	if allDigits {
+		return errors.New("username must contain a letter or underscore")
+	}
+
+	if _, ok := reservedUsernames[strings.ToLower(username)]; ok {
+		return errors.New("username is reserved")
+	}
+	return nil
+}
+
+// isUsernameTaken reports whether err is the database rejecting a duplicate
+// username.
+func isUsernameTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_username_lower_idx"
+}
+
+func isEmailTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key"
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func (cfg *apiConfig) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+
+	// look the user up regardless of case
+	id, err := cfg.Queries.GetUserIDByUsername(r.Context(), r.PathValue("username"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, 404, errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up username: %s", err)
+		respondWithJSON(w, 500, errorResponse{Error: "Internal server error"})
+		return
+	}
+
+	cfg.respondWithProfile(w, r, id)
+
+}